@@ -0,0 +1,110 @@
+package convert
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// bookIDs lists the USFM book codes in Paratext canon order; a book's number
+// is its index plus one.
+var bookIDs = []string{
+	"GEN", "EXO", "LEV", "NUM", "DEU", "JOS", "JDG", "RUT", "1SA", "2SA",
+	"1KI", "2KI", "1CH", "2CH", "EZR", "NEH", "EST", "JOB", "PSA", "PRO",
+	"ECC", "SNG", "ISA", "JER", "LAM", "EZK", "DAN", "HOS", "JOL", "AMO",
+	"OBA", "JON", "MIC", "NAM", "HAB", "ZEP", "HAG", "ZEC", "MAL",
+	"MAT", "MRK", "LUK", "JHN", "ACT", "ROM", "1CO", "2CO", "GAL", "EPH",
+	"PHP", "COL", "1TH", "2TH", "1TI", "2TI", "TIT", "PHM", "HEB", "JAS",
+	"1PE", "2PE", "1JN", "2JN", "3JN", "JUD", "REV",
+	"TOB", "JDT", "ESG", "WIS", "SIR", "BAR", "LJE", "S3Y", "SUS", "BEL",
+	"1MA", "2MA", "3MA", "4MA", "1ES", "2ES", "MAN", "PS2", "ODA", "PSS",
+	"JSA", "JDB", "TBS", "SST", "DNT", "BLT",
+	"XXA", "XXB", "XXC", "XXD", "XXE", "XXF", "XXG", "FRT", "BAK", "OTH",
+	"3ES", "EZA", "5EZ", "6EZ", "INT", "CNC", "GLO", "TDX", "NDX", "DAG",
+	"PS3", "2BA", "LBA", "JUB", "ENO", "1MQ", "2MQ", "3MQ", "REP", "4BA",
+	"LAO",
+}
+
+var bookNumbers = func() map[string]int {
+	numbers := make(map[string]int, len(bookIDs))
+	for i, code := range bookIDs {
+		numbers[code] = i + 1
+	}
+	return numbers
+}()
+
+// bookNumber returns the canon number of a book code, or 0 if it is unknown.
+func bookNumber(code string) int {
+	return bookNumbers[strings.ToUpper(code)]
+}
+
+// compareBookCodes orders books canonically. Unknown codes sort after all
+// known ones, alphabetically among themselves.
+func compareBookCodes(a, b string) int {
+	na, nb := bookNumber(a), bookNumber(b)
+	switch {
+	case na > 0 && nb > 0:
+		return na - nb
+	case na > 0:
+		return -1
+	case nb > 0:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// suggestBookCode guesses the standard code behind a malformed one, such as
+// MAT for MAT1 or 41MAT. It returns "" when there is no good guess.
+func suggestBookCode(code string) string {
+	upper := strings.ToUpper(strings.TrimSpace(code))
+	if len(upper) > 3 && bookNumber(upper[:3]) > 0 {
+		return upper[:3]
+	}
+	if len(upper) >= 5 && bookFileNumber(upper[2:5]) == upper[:2] {
+		return upper[2:5]
+	}
+	return ""
+}
+
+// resolveBookCode is the code a book is stored under: upper-cased when it
+// is a standard code, otherwise kept as written.
+func resolveBookCode(code string) string {
+	if upper := strings.ToUpper(code); bookNumber(upper) > 0 {
+		return upper
+	}
+	return code
+}
+
+// bookCodeFromFileName takes the book code from a file name: the whole base
+// name when it is a code (MAT.usfm), or the code after a Paratext book number
+// (41MATWEB.SFM). Otherwise the base name is returned unchanged.
+func bookCodeFromFileName(name string) string {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	upper := strings.ToUpper(base)
+	if bookNumber(upper) > 0 {
+		return upper
+	}
+	if len(upper) >= 5 && bookFileNumber(upper[2:5]) == upper[:2] {
+		return upper[2:5]
+	}
+	return base
+}
+
+// bookFileNumber returns the number Paratext puts in front of book file
+// names: 01-39 for the Old Testament, one higher from Matthew on (41MAT), and
+// A0, A1, ... B0 from FRT on (A0FRT). It is "" for unknown codes.
+func bookFileNumber(code string) string {
+	n := bookNumber(code)
+	switch {
+	case n == 0:
+		return ""
+	case n < 40:
+		return fmt.Sprintf("%02d", n)
+	case n < 100:
+		return fmt.Sprintf("%02d", n+1)
+	default:
+		n -= 100
+		return fmt.Sprintf("%c%d", 'A'+n/10, n%10)
+	}
+}
@@ -0,0 +1,344 @@
+package convert
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Bundle is a Digital Bible Library text bundle: a metadata.xml and the USX
+// books under release/. Source is the zip or folder it was opened from, and
+// book paths are given relative to Source. Books are listed in the bundle's
+// canonical order.
+type Bundle struct {
+	Source       string     `json:"source"`
+	ID           string     `json:"id,omitempty"`
+	Name         string     `json:"name"`
+	Abbreviation string     `json:"abbreviation,omitempty"`
+	Language     string     `json:"language,omitempty"`
+	LanguageName string     `json:"languageName,omitempty"`
+	BookOrder    []string   `json:"bookOrder"`
+	Books        []BookFile `json:"books"`
+
+	dir     string
+	tempDir string
+	files   []string
+}
+
+type dblBook struct {
+	Code string `xml:"code,attr"`
+}
+
+// dblMetadata covers both DBL 1.x (bookList) and 2.x (publications)
+// metadata.xml layouts.
+type dblMetadata struct {
+	ID             string `xml:"id,attr"`
+	Identification struct {
+		Name         string `xml:"name"`
+		Abbreviation string `xml:"abbreviation"`
+	} `xml:"identification"`
+	Language struct {
+		Iso  string `xml:"iso"`
+		Name string `xml:"name"`
+	} `xml:"language"`
+	Publications []struct {
+		Default   string    `xml:"default,attr"`
+		Canonical []dblBook `xml:"canonicalContent>book"`
+		Structure []struct {
+			Src  string `xml:"src,attr"`
+			Role string `xml:"role,attr"`
+		} `xml:"structure>content"`
+	} `xml:"publications>publication"`
+	BookLists []struct {
+		Default string    `xml:"default,attr"`
+		Books   []dblBook `xml:"books>book"`
+	} `xml:"bookList"`
+}
+
+// IsBundleDir reports whether dir holds a DBL metadata.xml.
+func IsBundleDir(dir string) bool {
+	return isFile(filepath.Join(dir, "metadata.xml"))
+}
+
+// FindBundleRoot returns the folder holding metadata.xml, either dir itself
+// or a single folder inside it as zips often wrap their contents; "" if
+// neither has one.
+func FindBundleRoot(dir string) string {
+	if IsBundleDir(dir) {
+		return dir
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && IsBundleDir(filepath.Join(dir, entry.Name())) {
+			return filepath.Join(dir, entry.Name())
+		}
+	}
+	return ""
+}
+
+// OpenBundle opens a DBL bundle from a folder or a .zip. A zip is extracted
+// to a temporary folder, which Close removes.
+func OpenBundle(source string) (*Bundle, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("Input path not found: %s", source)
+	}
+	if info.IsDir() {
+		root := FindBundleRoot(source)
+		if root == "" {
+			return nil, fmt.Errorf("No metadata.xml found in %s", source)
+		}
+		return loadBundle(root, source, "")
+	}
+
+	tempDir, err := os.MkdirTemp("", "usxtocsv-dbl-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := extractBundleZip(source, tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	root := FindBundleRoot(tempDir)
+	if root == "" {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("Not a DBL bundle (no metadata.xml): %s", source)
+	}
+	b, err := loadBundle(root, source, tempDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *Bundle) Close() error {
+	if b.tempDir == "" {
+		return nil
+	}
+	return os.RemoveAll(b.tempDir)
+}
+
+func loadBundle(dir, source, tempDir string) (*Bundle, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "metadata.xml"))
+	if err != nil {
+		return nil, err
+	}
+	var meta dblMetadata
+	if err := xml.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("Invalid metadata.xml in %s: %v", source, err)
+	}
+
+	b := &Bundle{
+		Source:       source,
+		ID:           meta.ID,
+		Name:         strings.TrimSpace(meta.Identification.Name),
+		Abbreviation: strings.TrimSpace(meta.Identification.Abbreviation),
+		Language:     strings.TrimSpace(meta.Language.Iso),
+		LanguageName: strings.TrimSpace(meta.Language.Name),
+		dir:          dir,
+		tempDir:      tempDir,
+	}
+
+	var srcs []BookFile
+	for i, pub := range meta.Publications {
+		if pub.Default != "true" && i != len(meta.Publications)-1 {
+			continue
+		}
+		for _, book := range pub.Canonical {
+			b.BookOrder = append(b.BookOrder, strings.ToUpper(book.Code))
+		}
+		for _, content := range pub.Structure {
+			if strings.ToLower(path.Ext(content.Src)) == ".usx" {
+				srcs = append(srcs, BookFile{Code: strings.ToUpper(content.Role), Path: content.Src})
+			}
+		}
+		break
+	}
+	if len(b.BookOrder) == 0 {
+		for i, list := range meta.BookLists {
+			if list.Default != "true" && i != len(meta.BookLists)-1 {
+				continue
+			}
+			for _, book := range list.Books {
+				b.BookOrder = append(b.BookOrder, strings.ToUpper(book.Code))
+			}
+			break
+		}
+	}
+
+	if len(srcs) == 0 {
+		matches, err := filepath.Glob(filepath.Join(dir, "release", "USX_*", "*.usx"))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			rel, _ := filepath.Rel(dir, match)
+			code := strings.ToUpper(strings.TrimSuffix(filepath.Base(match), filepath.Ext(match)))
+			srcs = append(srcs, BookFile{Code: code, Path: filepath.ToSlash(rel)})
+		}
+	}
+	for _, src := range srcs {
+		full := filepath.Join(dir, filepath.FromSlash(src.Path))
+		if !isFile(full) {
+			continue
+		}
+		b.Books = append(b.Books, BookFile{Code: src.Code, Path: full})
+	}
+	if len(b.Books) == 0 {
+		return nil, fmt.Errorf("No USX books found in DBL bundle %s", source)
+	}
+	if b.Name == "" {
+		b.Name = strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	}
+
+	order := map[string]int{}
+	for i, code := range b.BookOrder {
+		order[code] = i + 1
+	}
+	rank := func(code string) int {
+		if n, ok := order[code]; ok {
+			return n
+		}
+		return len(order) + bookNumber(code)
+	}
+	sort.SliceStable(b.Books, func(i, j int) bool {
+		return rank(b.Books[i].Code) < rank(b.Books[j].Code)
+	})
+	for i, book := range b.Books {
+		b.files = append(b.files, book.Path)
+		b.Books[i].Path = b.displayPath(book.Path)
+	}
+	if len(b.BookOrder) == 0 {
+		for _, book := range b.Books {
+			b.BookOrder = append(b.BookOrder, book.Code)
+		}
+	}
+	return b, nil
+}
+
+// Label names the translation in parallel output and CSV metadata.
+func (b *Bundle) Label() string {
+	if b.Abbreviation != "" {
+		return b.Abbreviation
+	}
+	return b.Name
+}
+
+// Files returns the paths of the book files on disk, in book order.
+func (b *Bundle) Files() []string {
+	return append([]string(nil), b.files...)
+}
+
+func (b *Bundle) owns(path string) bool {
+	for _, file := range b.files {
+		if samePath(file, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayPath names a file of an extracted zip as a path inside the zip,
+// since the extraction folder is gone once the run ends.
+func (b *Bundle) displayPath(path string) string {
+	if b.tempDir == "" {
+		return path
+	}
+	rel, err := filepath.Rel(b.tempDir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.Join(b.Source, rel)
+}
+
+// outputDir is where book outputs of the bundle go: next to the zip in a
+// folder named after it, or the folder holding metadata.xml. Under an output
+// folder they go where that folder would be mirrored.
+func (b *Bundle) outputDir(outputFolder string, roots []string) string {
+	if outputFolder != "" {
+		if b.tempDir != "" {
+			return outputFolder
+		}
+		return filepath.Join(outputFolder, mirroredDir(filepath.Join(b.dir, "metadata.xml"), roots))
+	}
+	if b.tempDir != "" {
+		return strings.TrimSuffix(b.Source, filepath.Ext(b.Source))
+	}
+	return b.dir
+}
+
+// inputName is how a file is named in progress output and results.
+func inputName(path string, opts Options) string {
+	if b := bundleFor(path, opts.Bundles); b != nil {
+		return b.displayPath(path)
+	}
+	return path
+}
+
+func bundleFor(path string, bundles []*Bundle) *Bundle {
+	for _, b := range bundles {
+		if b.owns(path) {
+			return b
+		}
+	}
+	return nil
+}
+
+func extractBundleZip(zipPath, destDir string) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("Failed to open zip: %s", zipPath)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		name := path.Clean("/" + strings.ReplaceAll(file.Name, "\\", "/"))
+		if name == "/" {
+			continue
+		}
+		target := filepath.Join(destDir, filepath.FromSlash(name[1:]))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := extractZipFile(file, target); err != nil {
+			return fmt.Errorf("Failed to extract %s from %s: %v", file.Name, zipPath, err)
+		}
+	}
+	return nil
+}
+
+func extractZipFile(file *zip.File, target string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.Close()
+		return err
+	}
+	return dest.Close()
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -1,70 +1,94 @@
 package convert
 
 import (
-	"encoding/csv"
-	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 )
 
-type Options struct {
-	Quiet bool
-}
+var (
+	errUnsupportedInput = errors.New("Input must be a .usx, .usfm, .sfm, .usj, or .json file, or a folder containing them.")
+	errUnsupportedCsv   = errors.New("Input must be a .csv file, or a folder containing them.")
+)
 
-type FileResult struct {
-	Input  string `json:"input"`
-	Output string `json:"output"`
-	Format string `json:"format"`
-	Rows   int    `json:"rows"`
-}
+const (
+	OutputCSV   = "csv"
+	OutputJSON  = "json"
+	OutputJSONL = "jsonl"
+	OutputUSFM  = "usfm"
+	OutputUSX   = "usx"
+)
 
-type Summary struct {
-	Files []FileResult `json:"files"`
+type Options struct {
+	Quiet               bool
+	OutputFormat        string
+	PreserveOrder       bool
+	Versification       *Versification
+	TargetVersification *Versification
+	FillGaps            bool
+	Parallel            bool
+	Merge               string
+	NoteMode            string
+	NotesCSV            bool
+	Overwrite           bool
+	Labels              []string
+	InputRoots          []string
+	Projects            []*Project
+	Bundles             []*Bundle
+	NameTemplate        string
+	Language            string
+	OnCollision         string
+	Jobs                int
+	KeepGoing           bool
 }
 
-type nodeType int
-
 const (
-	nodeElement nodeType = iota
-	nodeText
+	StatusOK     = "ok"
+	StatusFailed = "failed"
 )
 
-type node struct {
-	Type     nodeType
-	Name     string
-	Attrs    map[string]string
-	Children []*node
-	Text     string
+// FileResult reports one input. Warnings are the parser issues noticed in
+// the file; Error is set only when Status is StatusFailed.
+type FileResult struct {
+	Input         string               `json:"input"`
+	Output        string               `json:"output"`
+	Notes         string               `json:"notes,omitempty"`
+	Format        string               `json:"format"`
+	Rows          int                  `json:"rows"`
+	Status        string               `json:"status"`
+	Error         string               `json:"error,omitempty"`
+	Warnings      []Issue              `json:"warnings,omitempty"`
+	Versification *VersificationReport `json:"versification,omitempty"`
+}
+
+type Summary struct {
+	Files    []FileResult     `json:"files"`
+	Failed   int              `json:"failed"`
+	Projects []*Project       `json:"projects,omitempty"`
+	Bundles  []*Bundle        `json:"bundles,omitempty"`
+	Parallel []ParallelResult `json:"parallel,omitempty"`
+	Merged   *MergeResult     `json:"merged,omitempty"`
 }
 
-type row struct {
-	Book       string
-	Chapter    string
-	Verse      string
-	TextPlain  string
-	TextStyled string
-	Footnotes  string
-	Crossrefs  string
-	Subtitle   string
+// failedResult records a file that could not be converted under KeepGoing.
+func failedResult(path string, err error, opts Options) FileResult {
+	progressf(opts, "Failed %s: %v", inputName(path, opts), err)
+	return FileResult{Input: inputName(path, opts), Status: StatusFailed, Error: err.Error()}
 }
 
-type usxState struct {
-	bookCode        string
-	currentChapter  string
-	currentVerse    string
-	currentPlain    string
-	currentStyled   string
-	currentFootnote []string
-	currentCrossref []string
-	currentSubtitle string
-	rows            []row
+func countFailed(results []FileResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.Status == StatusFailed {
+			failed++
+		}
+	}
+	return failed
 }
 
 func ResolveInputItems(inputs []string) ([]string, error) {
@@ -100,7 +124,24 @@ func ResolveInputItems(inputs []string) ([]string, error) {
 	return items, nil
 }
 
-func CollectFiles(items []string) ([]string, error) {
+// CollectOptions controls how folders are scanned. Include and Exclude are
+// glob patterns matched against a file's name or its slash-separated path
+// relative to the folder; Exclude also prunes matching subfolders. CSV
+// collects .csv files instead of source files, leaving out notes tables.
+type CollectOptions struct {
+	Recursive bool
+	Include   []string
+	Exclude   []string
+	CSV       bool
+}
+
+func CollectFiles(items []string, opts CollectOptions) ([]string, error) {
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern: %s", pattern)
+		}
+	}
+
 	var files []string
 
 	for _, item := range items {
@@ -110,25 +151,19 @@ func CollectFiles(items []string) ([]string, error) {
 		}
 
 		if info.IsDir() {
-			entries, err := os.ReadDir(item)
+			dirFiles, err := collectDir(item, opts)
 			if err != nil {
 				return nil, err
 			}
-			for _, entry := range entries {
-				if entry.IsDir() {
-					continue
-				}
-				ext := strings.ToLower(filepath.Ext(entry.Name()))
-				if isSupportedExt(ext) {
-					files = append(files, filepath.Join(item, entry.Name()))
-				}
-			}
+			files = append(files, dirFiles...)
 			continue
 		}
 
-		ext := strings.ToLower(filepath.Ext(item))
-		if !isSupportedExt(ext) {
-			return nil, errors.New("Input must be a .usx, .usfm, or .sfm file, or a folder containing them.")
+		if !opts.accepts(strings.ToLower(filepath.Ext(item))) {
+			if opts.CSV {
+				return nil, errUnsupportedCsv
+			}
+			return nil, errUnsupportedInput
 		}
 		files = append(files, item)
 	}
@@ -136,576 +171,354 @@ func CollectFiles(items []string) ([]string, error) {
 	return files, nil
 }
 
-func ConvertFiles(paths []string, outputFolder string, opts Options) (Summary, error) {
-	if outputFolder != "" {
-		if err := os.MkdirAll(outputFolder, 0o755); err != nil {
-			return Summary{}, err
+func collectDir(root string, opts CollectOptions) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
-	}
-
-	runSummary := Summary{}
-	for _, path := range paths {
-		result, err := ConvertFile(path, outputFolder, opts)
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
 		if err != nil {
-			return Summary{}, err
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if entry.IsDir() {
+			if !opts.Recursive || matchesAny(opts.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
 		}
-		runSummary.Files = append(runSummary.Files, result)
-	}
-
-	return runSummary, nil
-}
-
-func ConvertFile(path, outputFolder string, opts Options) (FileResult, error) {
-	ext := strings.ToLower(filepath.Ext(path))
-	csvPath := outputPath(path, outputFolder)
 
-	switch ext {
-	case ".usx":
-		rows, err := convertUsxToCsv(path, csvPath, opts.Quiet)
-		if err != nil {
-			return FileResult{}, err
+		ext := strings.ToLower(filepath.Ext(p))
+		if !opts.accepts(ext) {
+			return nil
 		}
-		return FileResult{
-			Input:  path,
-			Output: csvPath,
-			Format: "usx",
-			Rows:   rows,
-		}, nil
-	case ".usfm", ".sfm":
-		rows, err := convertUsfmToCsv(path, csvPath, opts.Quiet)
-		if err != nil {
-			return FileResult{}, err
+		if opts.CSV && strings.HasSuffix(strings.ToLower(p), ".notes.csv") {
+			return nil
 		}
-		format := strings.TrimPrefix(ext, ".")
-		return FileResult{
-			Input:  path,
-			Output: csvPath,
-			Format: format,
-			Rows:   rows,
-		}, nil
-	default:
-		return FileResult{}, errors.New("Input must be a .usx, .usfm, or .sfm file, or a folder containing them.")
-	}
+		if len(opts.Include) > 0 && !matchesAny(opts.Include, rel) {
+			return nil
+		}
+		if matchesAny(opts.Exclude, rel) {
+			return nil
+		}
+		if ext == ".json" && !LooksLikeUsj(p) {
+			return nil
+		}
+		files = append(files, p)
+		return nil
+	})
+	return files, err
 }
 
-func outputPath(inputPath, outputFolder string) string {
-	if outputFolder != "" {
-		base := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
-		return filepath.Join(outputFolder, base+".csv")
+func (opts CollectOptions) accepts(ext string) bool {
+	if opts.CSV {
+		return ext == ".csv"
 	}
-	return strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + ".csv"
+	return isSupportedExt(ext)
 }
 
-func isSupportedExt(ext string) bool {
-	switch ext {
-	case ".usx", ".usfm", ".sfm":
-		return true
-	default:
-		return false
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
 	}
+	return false
 }
 
-func hasWildcard(path string) bool {
-	return strings.ContainsAny(path, "*?[]")
-}
-
-func convertUsxToCsv(usxPath, csvPath string, quiet bool) (int, error) {
-	if !quiet {
-		fmt.Fprintf(os.Stderr, "Processing (USX) %s\n", usxPath)
-	}
-	root, err := parseXML(usxPath)
-	if err != nil {
-		return 0, err
-	}
-
-	if root == nil || root.Name != "usx" {
-		return 0, fmt.Errorf("No <usx> root found in %s", usxPath)
-	}
-
-	bookNode := findFirstChild(root, "book")
-	if bookNode == nil {
-		return 0, fmt.Errorf("No <book> found in %s", usxPath)
+func ConvertFiles(paths []string, outputFolder string, opts Options) (Summary, error) {
+	if err := validateOutputFormat(opts.OutputFormat); err != nil {
+		return Summary{}, err
 	}
-
-	state := &usxState{
-		bookCode: getAttrValue(bookNode, "code"),
+	if err := validateNoteMode(opts.NoteMode); err != nil {
+		return Summary{}, err
 	}
-
-	for _, child := range root.Children {
-		processUsxNode(child, state)
+	if outputFolder != "" {
+		if err := os.MkdirAll(outputFolder, 0o755); err != nil {
+			return Summary{}, err
+		}
 	}
 
-	sortRows(state.rows)
-	if err := writeCsv(csvPath, state.rows); err != nil {
-		return 0, err
+	if opts.Merge != "" {
+		runSummary, err := convertMerged(paths, opts)
+		if err != nil {
+			return Summary{}, err
+		}
+		runSummary.Projects = opts.Projects
+		runSummary.Bundles = opts.Bundles
+		return runSummary, nil
 	}
-
-	if !quiet {
-		fmt.Fprintf(os.Stderr, "Created CSV: %s\n", csvPath)
+	if opts.Parallel {
+		runSummary, err := convertParallel(paths, outputFolder, opts)
+		if err != nil {
+			return Summary{}, err
+		}
+		runSummary.Projects = opts.Projects
+		runSummary.Bundles = opts.Bundles
+		return runSummary, nil
 	}
-	return len(state.rows), nil
-}
 
-func convertUsfmToCsv(usfmPath, csvPath string, quiet bool) (int, error) {
-	if !quiet {
-		fmt.Fprintf(os.Stderr, "Processing (USFM/SFM) %s\n", usfmPath)
-	}
-	data, err := os.ReadFile(usfmPath)
+	outputs, err := planOutputs(paths, outputFolder, opts)
 	if err != nil {
-		return 0, err
-	}
-
-	content := strings.ReplaceAll(string(data), "\r\n", "\n")
-	lines := strings.Split(content, "\n")
-
-	bookCode := strings.TrimSuffix(filepath.Base(usfmPath), filepath.Ext(usfmPath))
-	reID := regexp.MustCompile(`(?i)^\\id\s+(\S+)`)
-	for _, line := range lines {
-		l := strings.TrimSpace(line)
-		if l == "" {
-			continue
-		}
-		if m := reID.FindStringSubmatch(l); len(m) > 1 {
-			bookCode = m[1]
-			break
-		}
+		return Summary{}, err
 	}
 
-	var rows []row
-	currentChapter := ""
-	currentVerse := ""
-	currentPlain := ""
-	currentStyled := ""
-	currentFootnotes := []string{}
-	currentCrossrefs := []string{}
-	currentSubtitle := ""
-
-	reChapter := regexp.MustCompile(`(?i)^\\c\s+(\d+)\b`)
-	reHeading := regexp.MustCompile(`(?i)^\\(s[0-3]?|sp|ms|mr|mt[12]?)\s*(.*)$`)
-	reVerse := regexp.MustCompile(`(?i)^\\v\s+(\d+)\s*(.*)$`)
-	rePara := regexp.MustCompile(`(?i)^\\(m|p|pi|q[0-4]?|qt[0-4]?)\s*(.*)$`)
-
-	for _, line := range lines {
-		l := strings.TrimSpace(line)
-		if l == "" {
-			continue
-		}
-
-		if m := reChapter.FindStringSubmatch(l); len(m) > 1 {
-			if currentVerse != "" {
-				addCurrentVerseUsfm(&rows, bookCode, currentChapter, currentVerse, currentPlain, currentStyled, currentFootnotes, currentCrossrefs, currentSubtitle)
-			}
-			currentVerse = ""
-			currentPlain = ""
-			currentStyled = ""
-			currentFootnotes = []string{}
-			currentCrossrefs = []string{}
-
-			currentChapter = m[1]
-			continue
-		}
-
-		if m := reHeading.FindStringSubmatch(l); len(m) > 1 {
-			headText := m[2]
-			headText = extractNotesFromUsfmSegment(headText, &currentFootnotes, &currentCrossrefs)
-			headText = regexp.MustCompile(`(?i)\\\+?[a-z0-9]+\*?`).ReplaceAllString(headText, " ")
-			headText = normalizeWhitespace(headText)
-			if headText != "" {
-				currentSubtitle = headText
-			}
-			continue
-		}
-
-		if m := reVerse.FindStringSubmatch(l); len(m) > 1 {
-			if currentVerse != "" {
-				addCurrentVerseUsfm(&rows, bookCode, currentChapter, currentVerse, currentPlain, currentStyled, currentFootnotes, currentCrossrefs, currentSubtitle)
-			}
-
-			currentVerse = m[1]
-			currentPlain = ""
-			currentStyled = ""
-			currentFootnotes = []string{}
-			currentCrossrefs = []string{}
-
-			rest := m[2]
-			if rest != "" {
-				processUsfmContentSegment(rest, &currentPlain, &currentStyled, &currentFootnotes, &currentCrossrefs)
-			}
-			continue
-		}
-
-		if m := rePara.FindStringSubmatch(l); len(m) > 1 {
-			rest := m[2]
-			if currentVerse != "" && rest != "" {
-				processUsfmContentSegment(rest, &currentPlain, &currentStyled, &currentFootnotes, &currentCrossrefs)
+	results := make([]FileResult, len(paths))
+	err = runJobs(len(paths), jobCount(opts, len(paths)), func(i int) error {
+		result, err := convertFile(paths[i], outputs[i], opts)
+		if err != nil {
+			if !opts.KeepGoing {
+				return err
 			}
-			continue
-		}
-
-		if currentVerse != "" {
-			processUsfmContentSegment(l, &currentPlain, &currentStyled, &currentFootnotes, &currentCrossrefs)
+			result = failedResult(paths[i], err, opts)
 		}
+		results[i] = result
+		return nil
+	})
+	if err != nil {
+		return Summary{}, err
 	}
 
-	if currentVerse != "" {
-		addCurrentVerseUsfm(&rows, bookCode, currentChapter, currentVerse, currentPlain, currentStyled, currentFootnotes, currentCrossrefs, currentSubtitle)
-	}
+	return Summary{
+		Files:    results,
+		Failed:   countFailed(results),
+		Projects: opts.Projects,
+		Bundles:  opts.Bundles,
+	}, nil
+}
 
-	sortRows(rows)
-	if err := writeCsv(csvPath, rows); err != nil {
-		return 0, err
+func ConvertFile(path, outputFolder string, opts Options) (FileResult, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if !isSupportedExt(ext) {
+		return FileResult{}, errUnsupportedInput
 	}
-
-	if !quiet {
-		fmt.Fprintf(os.Stderr, "Created CSV: %s\n", csvPath)
+	if err := validateOutputFormat(opts.OutputFormat); err != nil {
+		return FileResult{}, err
 	}
-	return len(rows), nil
-}
-
-func addCurrentVerseUsfm(rows *[]row, book, chapter, verse, plain, styled string, footnotes, crossrefs []string, subtitle string) {
-	plain = strings.TrimSpace(plain)
-	styled = strings.TrimSpace(styled)
-	subtitle = strings.TrimSpace(subtitle)
-
-	if book != "" && chapter != "" && verse != "" && plain != "" {
-		*rows = append(*rows, row{
-			Book:       book,
-			Chapter:    chapter,
-			Verse:      verse,
-			TextPlain:  plain,
-			TextStyled: styled,
-			Footnotes:  strings.Join(footnotes, " | "),
-			Crossrefs:  strings.Join(crossrefs, " | "),
-			Subtitle:   subtitle,
-		})
+	if err := validateNoteMode(opts.NoteMode); err != nil {
+		return FileResult{}, err
+	}
+	if err := validateNameTemplate(opts.NameTemplate); err != nil {
+		return FileResult{}, err
 	}
+	return convertFile(path, outputPath(path, outputFolder, opts), opts)
 }
 
-func processUsfmContentSegment(segment string, currentPlain, currentStyled *string, footnotes, crossrefs *[]string) {
-	if strings.TrimSpace(segment) == "" {
-		return
+func convertFile(path, outPath string, opts Options) (FileResult, error) {
+	format := outputFormat(opts)
+	if samePath(outPath, path) {
+		return FileResult{}, fmt.Errorf("Output would overwrite input: %s", path)
 	}
-
-	reSup := regexp.MustCompile(`(?is)\\\+?sup\b.*?\\\+?sup\*`)
-	seg := reSup.ReplaceAllString(segment, " ")
-
-	seg = extractNotesFromUsfmSegment(seg, footnotes, crossrefs)
-	if strings.TrimSpace(seg) == "" {
-		return
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+		return FileResult{}, err
 	}
 
-	styleMap := map[string]string{
-		"wj":   "wj",
-		"add":  "add",
-		"nd":   "nd",
-		"it":   "i",
-		"bd":   "b",
-		"bdit": "bdit",
+	doc, report, err := loadDocument(path, opts)
+	if err != nil {
+		return FileResult{}, err
 	}
 
-	styled := seg
-	for key, tag := range styleMap {
-		reOpen := regexp.MustCompile(fmt.Sprintf(`(?i)\\\+?%s\b\s*`, key))
-		reClose := regexp.MustCompile(fmt.Sprintf(`(?i)\\\+?%s\*\s*`, key))
-		styled = reOpen.ReplaceAllString(styled, "<"+tag+">")
-		styled = reClose.ReplaceAllString(styled, "</"+tag+">")
+	rows, err := writeOutput(outPath, doc, format, opts.NoteMode)
+	if err != nil {
+		return FileResult{}, err
 	}
 
-	reUnknown := regexp.MustCompile(`(?i)\\\+?[a-z0-9]+\*?`)
-	styled = normalizeWhitespace(reUnknown.ReplaceAllString(styled, " "))
-	plain := normalizeWhitespace(reUnknown.ReplaceAllString(seg, " "))
+	progressf(opts, "Created %s: %s", strings.ToUpper(format), outPath)
 
-	if plain != "" {
-		if *currentPlain != "" {
-			*currentPlain += " "
-			*currentStyled += " "
+	notes := ""
+	if opts.NotesCSV {
+		notes = notesPath(outPath)
+		if _, err := writeNotesCsv(notes, doc); err != nil {
+			return FileResult{}, err
 		}
-		*currentPlain += plain
-		*currentStyled += styled
-	}
-}
-
-func extractNotesFromUsfmSegment(segment string, footnotes, crossrefs *[]string) string {
-	if strings.TrimSpace(segment) == "" {
-		return segment
-	}
-
-	reFoot := regexp.MustCompile(`(?is)\\f\b(.*?\\f\*)`)
-	text := reFoot.ReplaceAllStringFunc(segment, func(m string) string {
-		sub := reFoot.FindStringSubmatch(m)
-		if len(sub) > 1 {
-			full := `\f` + sub[1]
-			ftText := extractFtFromUsfmNoteText(full)
-			if ftText != "" {
-				*footnotes = append(*footnotes, ftText)
+		progressf(opts, "Created notes CSV: %s", notes)
+	}
+	return FileResult{
+		Input:         inputName(path, opts),
+		Output:        outPath,
+		Notes:         notes,
+		Format:        doc.Format,
+		Rows:          rows,
+		Status:        StatusOK,
+		Warnings:      doc.Issues,
+		Versification: report,
+	}, nil
+}
+
+// loadDocuments loads every path on the worker pool for modes that combine
+// files into shared outputs. Results carry everything but Output; under
+// KeepGoing a failed file leaves a nil document and a failed result.
+func loadDocuments(paths []string, opts Options) ([]*Document, []FileResult, error) {
+	docs := make([]*Document, len(paths))
+	results := make([]FileResult, len(paths))
+	err := runJobs(len(paths), jobCount(opts, len(paths)), func(i int) error {
+		doc, report, err := loadDocument(paths[i], opts)
+		if err != nil {
+			if !opts.KeepGoing {
+				return err
 			}
+			results[i] = failedResult(paths[i], err, opts)
+			return nil
 		}
-		return " "
-	})
-
-	reCross := regexp.MustCompile(`(?is)\\x\b(.*?\\x\*)`)
-	text = reCross.ReplaceAllStringFunc(text, func(m string) string {
-		sub := reCross.FindStringSubmatch(m)
-		if len(sub) > 1 {
-			full := `\x` + sub[1]
-			ftText := extractFtFromUsfmNoteText(full)
-			if ftText != "" {
-				*crossrefs = append(*crossrefs, ftText)
-			}
+		rows := 0
+		doc.eachRow(func(*Book, *Chapter, *Verse) error {
+			rows++
+			return nil
+		})
+		docs[i] = doc
+		results[i] = FileResult{
+			Input:         inputName(paths[i], opts),
+			Format:        doc.Format,
+			Rows:          rows,
+			Status:        StatusOK,
+			Warnings:      doc.Issues,
+			Versification: report,
 		}
-		return " "
+		return nil
 	})
-
-	return text
-}
-
-func extractFtFromUsfmNoteText(noteText string) string {
-	if strings.TrimSpace(noteText) == "" {
-		return ""
-	}
-
-	re := regexp.MustCompile(`(?i)\\ft\b([^\\]*)`)
-	m := re.FindStringSubmatch(noteText)
-	if len(m) < 2 {
-		return ""
+	if err != nil {
+		return nil, nil, err
 	}
-	return normalizeWhitespace(m[1])
+	return docs, results, nil
 }
 
-func parseXML(path string) (*node, error) {
-	file, err := os.Open(path)
+// loadDocument parses a file and applies the document-level options:
+// versification mapping and checks, then sorting.
+func loadDocument(path string, opts Options) (*Document, *VersificationReport, error) {
+	progressf(opts, "Processing (%s) %s", formatLabel(strings.ToLower(filepath.Ext(path))), inputName(path, opts))
+	doc, err := parseInput(path, opts.Projects)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	printIssues(path, doc.Issues, opts)
+	if bundle := bundleFor(path, opts.Bundles); bundle != nil {
+		doc.Language = bundle.Language
+		doc.Translation = bundle.Label()
 	}
-	defer file.Close()
-
-	decoder := xml.NewDecoder(file)
-	var stack []*node
-	var root *node
 
-	for {
-		tok, err := decoder.Token()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
+	source := opts.Versification
+	if project, _ := projectFor(path, opts.Projects); project != nil && source == nil {
+		source = project.versification
+	}
+	scheme := source
+	if opts.TargetVersification != nil {
+		if source == nil {
+			return nil, nil, errors.New("A target versification requires a source versification.")
 		}
+		remapDocument(doc, source, opts.TargetVersification)
+		scheme = opts.TargetVersification
+	}
 
-		switch t := tok.(type) {
-		case xml.StartElement:
-			n := &node{
-				Type:  nodeElement,
-				Name:  t.Name.Local,
-				Attrs: map[string]string{},
-			}
-			for _, attr := range t.Attr {
-				n.Attrs[attr.Name.Local] = attr.Value
-			}
-			if len(stack) > 0 {
-				parent := stack[len(stack)-1]
-				parent.Children = append(parent.Children, n)
-			} else {
-				root = n
-			}
-			stack = append(stack, n)
-		case xml.EndElement:
-			if len(stack) > 0 {
-				stack = stack[:len(stack)-1]
-			}
-		case xml.CharData:
-			if len(stack) == 0 {
-				continue
-			}
-			text := string(t)
-			if text == "" {
-				continue
-			}
-			n := &node{
-				Type: nodeText,
-				Text: text,
-			}
-			parent := stack[len(stack)-1]
-			parent.Children = append(parent.Children, n)
-		}
+	var report *VersificationReport
+	if scheme != nil {
+		report = checkVersification(doc, scheme, opts.FillGaps)
+		printVersificationReport(report, opts)
 	}
 
-	return root, nil
+	if !opts.PreserveOrder {
+		sortDocument(doc)
+	}
+	return doc, report, nil
 }
 
-func processUsxNode(n *node, state *usxState) {
-	if n == nil {
-		return
-	}
-
-	switch n.Type {
-	case nodeElement:
-		switch n.Name {
-		case "chapter":
-			state.currentChapter = getAttrValue(n, "number")
-			return
-		case "verse":
-			sid := getAttrValue(n, "sid")
-			eid := getAttrValue(n, "eid")
-			if sid != "" {
-				state.currentVerse = getAttrValue(n, "number")
-				state.currentPlain = ""
-				state.currentStyled = ""
-				state.currentFootnote = []string{}
-				state.currentCrossref = []string{}
-				return
-			}
-			if eid != "" {
-				state.addCurrentVerse()
-				state.currentVerse = ""
-				state.currentPlain = ""
-				state.currentStyled = ""
-				state.currentFootnote = []string{}
-				state.currentCrossref = []string{}
-				return
-			}
-		case "note":
-			processUsxNote(n, state)
-			return
-		case "para":
-			style := getAttrValue(n, "style")
-			if isSubtitleStyle(style) {
-				subText := normalizeWhitespace(innerText(n))
-				if subText != "" {
-					state.currentSubtitle = subText
-				}
-			}
-		case "char":
-			style := getAttrValue(n, "style")
-			if style == "sup" {
-				return
-			}
-			tag := ""
-			if style != "" {
-				tag = getStyledTagName(style)
-			}
-			if state.currentVerse != "" && tag != "" {
-				state.currentStyled += "<" + tag + ">"
-			}
-			for _, child := range n.Children {
-				processUsxNode(child, state)
-			}
-			if state.currentVerse != "" && tag != "" {
-				state.currentStyled += "</" + tag + ">"
-			}
-			return
-		}
-
-		for _, child := range n.Children {
-			processUsxNode(child, state)
-		}
-	case nodeText:
-		if state.currentVerse == "" {
-			return
-		}
-		text := normalizeWhitespace(n.Text)
-		if text == "" {
-			return
-		}
-		if state.currentPlain != "" {
-			state.currentPlain += " "
-			state.currentStyled += " "
+// printIssues shows parser warnings such as unknown book codes as progress,
+// so they are seen without -json.
+func printIssues(path string, issues []Issue, opts Options) {
+	for _, issue := range issues {
+		location := inputName(path, opts)
+		if issue.Line > 0 {
+			location = fmt.Sprintf("%s:%d:%d", location, issue.Line, issue.Column)
 		}
-		state.currentPlain += text
-		state.currentStyled += text
+		progressf(opts, "Warning %s: %s (%s)", location, issue.Message, issue.Code)
 	}
 }
 
-func (s *usxState) addCurrentVerse() {
-	plain := strings.TrimSpace(s.currentPlain)
-	styled := strings.TrimSpace(s.currentStyled)
-	subText := strings.TrimSpace(s.currentSubtitle)
-
-	if s.bookCode != "" && s.currentChapter != "" && s.currentVerse != "" && plain != "" {
-		s.rows = append(s.rows, row{
-			Book:       s.bookCode,
-			Chapter:    s.currentChapter,
-			Verse:      s.currentVerse,
-			TextPlain:  plain,
-			TextStyled: styled,
-			Footnotes:  strings.Join(s.currentFootnote, " | "),
-			Crossrefs:  strings.Join(s.currentCrossref, " | "),
-			Subtitle:   subText,
-		})
+func printVersificationReport(report *VersificationReport, opts Options) {
+	for _, book := range report.Books {
+		progressf(opts, "Versification (%s) %s: %d missing, %d extra", report.Name, book.Book, len(book.Missing), len(book.Extra))
 	}
 }
 
-func processUsxNote(noteNode *node, state *usxState) {
-	style := getAttrValue(noteNode, "style")
-	ft := extractFtFromNote(noteNode)
-	if ft == "" {
-		return
-	}
-
-	if strings.HasPrefix(style, "x") {
-		state.currentCrossref = append(state.currentCrossref, ft)
-	} else {
-		state.currentFootnote = append(state.currentFootnote, ft)
+// ParseFile reads a .usx, .usfm, .sfm, .usj or .json file into a Document
+// without writing any output.
+func ParseFile(path string) (*Document, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".usx":
+		return parseUsxFile(path)
+	case ".usfm", ".sfm":
+		return parseUsfmFile(path)
+	case ".usj", ".json":
+		return parseUsjFile(path)
+	default:
+		return nil, errUnsupportedInput
 	}
 }
 
-func extractFtFromNote(noteNode *node) string {
-	ftNode := findFtNode(noteNode)
-	if ftNode == nil {
-		return ""
+func outputFormat(opts Options) string {
+	if opts.OutputFormat == "" {
+		return OutputCSV
 	}
-	raw := innerText(ftNode)
-	if strings.TrimSpace(raw) == "" {
-		return ""
-	}
-	return normalizeWhitespace(raw)
+	return opts.OutputFormat
 }
 
-func findFtNode(n *node) *node {
-	if n == nil {
+func validateOutputFormat(format string) error {
+	switch format {
+	case "", OutputCSV, OutputJSON, OutputJSONL:
 		return nil
+	default:
+		return fmt.Errorf("Unknown output format: %s (use csv, json, or jsonl)", format)
 	}
-	if n.Type == nodeElement && n.Name == "char" {
-		if getAttrValue(n, "style") == "ft" {
-			return n
-		}
-	}
-	for _, child := range n.Children {
-		if found := findFtNode(child); found != nil {
-			return found
-		}
-	}
-	return nil
 }
 
-func innerText(n *node) string {
-	if n == nil {
-		return ""
-	}
-	if n.Type == nodeText {
-		return n.Text
+func writeOutput(path string, doc *Document, format, noteMode string) (int, error) {
+	switch format {
+	case OutputJSON:
+		return writeJSON(path, doc, false, noteMode)
+	case OutputJSONL:
+		return writeJSON(path, doc, true, noteMode)
+	default:
+		return writeCsv(path, doc, noteMode)
 	}
-	var b strings.Builder
-	for _, child := range n.Children {
-		b.WriteString(innerText(child))
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return a == b
 	}
-	return b.String()
+	return absA == absB
 }
 
-func findFirstChild(n *node, name string) *node {
-	for _, child := range n.Children {
-		if child.Type == nodeElement && child.Name == name {
-			return child
-		}
+func isSupportedExt(ext string) bool {
+	switch ext {
+	case ".usx", ".usfm", ".sfm", ".usj", ".json":
+		return true
+	default:
+		return false
 	}
-	return nil
 }
 
-func getAttrValue(n *node, name string) string {
-	if n == nil || n.Attrs == nil {
-		return ""
+func hasWildcard(path string) bool {
+	return strings.ContainsAny(path, "*?[]")
+}
+
+func formatLabel(ext string) string {
+	switch ext {
+	case ".usx":
+		return "USX"
+	case ".usj", ".json":
+		return "USJ"
+	default:
+		return "USFM/SFM"
 	}
-	return n.Attrs[name]
 }
 
 func normalizeWhitespace(text string) string {
@@ -734,6 +547,24 @@ func getStyledTagName(style string) string {
 	}
 }
 
+// styleForTagName maps a TextStyled tag back to its USFM character style. The
+// catch-all span tag becomes \no, which getStyledTagName turns back into
+// span, so its text stays styled through USFM or USX and back.
+func styleForTagName(tag string) string {
+	switch tag {
+	case "wj", "add", "nd", "bdit":
+		return tag
+	case "i":
+		return "it"
+	case "b":
+		return "bd"
+	case "span":
+		return "no"
+	default:
+		return ""
+	}
+}
+
 func isSubtitleStyle(style string) bool {
 	switch style {
 	case "s", "s1", "s2", "s3", "sp", "ms", "mr", "mt", "mt1", "mt2":
@@ -743,20 +574,6 @@ func isSubtitleStyle(style string) bool {
 	}
 }
 
-func sortRows(rows []row) {
-	sort.Slice(rows, func(i, j int) bool {
-		if rows[i].Book != rows[j].Book {
-			return rows[i].Book < rows[j].Book
-		}
-		ci := parseInt(rows[i].Chapter)
-		cj := parseInt(rows[j].Chapter)
-		if ci != cj {
-			return ci < cj
-		}
-		return rows[i].Verse < rows[j].Verse
-	})
-}
-
 func parseInt(v string) int {
 	n, err := strconv.Atoi(v)
 	if err != nil {
@@ -764,23 +581,3 @@ func parseInt(v string) int {
 	}
 	return n
 }
-
-func writeCsv(path string, rows []row) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	if err := writer.Write([]string{"Book", "Chapter", "Verse", "TextPlain", "TextStyled", "Footnotes", "Crossrefs", "Subtitle"}); err != nil {
-		return err
-	}
-	for _, r := range rows {
-		if err := writer.Write([]string{r.Book, r.Chapter, r.Verse, r.TextPlain, r.TextStyled, r.Footnotes, r.Crossrefs, r.Subtitle}); err != nil {
-			return err
-		}
-	}
-	writer.Flush()
-	return writer.Error()
-}
@@ -0,0 +1,71 @@
+package convert
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+)
+
+var csvHeader = []string{"Book", "Chapter", "Verse", "TextPlain", "TextStyled", "Footnotes", "Crossrefs", "Subtitle", "VerseStart", "VerseEnd", "Segment"}
+
+var csvMetaHeader = []string{"Language", "Translation"}
+
+func writeCsv(path string, doc *Document, noteMode string) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	header := csvHeader
+	withMeta := hasCsvMeta(doc)
+	if withMeta {
+		header = append(append([]string{}, header...), csvMetaHeader...)
+	}
+	if err := writer.Write(header); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	err = doc.eachRow(func(book *Book, chapter *Chapter, verse *Verse) error {
+		rows++
+		return writer.Write(csvRecord(doc, book, chapter, verse, withMeta, noteMode))
+	})
+	if err != nil {
+		return 0, err
+	}
+	writer.Flush()
+	return rows, writer.Error()
+}
+
+func hasCsvMeta(doc *Document) bool {
+	return doc.Language != "" || doc.Translation != ""
+}
+
+func csvRecord(doc *Document, book *Book, chapter *Chapter, verse *Verse, withMeta bool, noteMode string) []string {
+	record := []string{
+		book.Code,
+		chapter.Number,
+		verse.Number,
+		verse.PlainText(),
+		verse.StyledText(),
+		verse.noteCell(false, noteMode),
+		verse.noteCell(true, noteMode),
+		verse.Subtitle,
+		formatVerseInt(verse.Start),
+		formatVerseInt(verse.End),
+		verse.Segment,
+	}
+	if withMeta {
+		record = append(record, doc.Language, doc.Translation)
+	}
+	return record
+}
+
+func formatVerseInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,152 @@
+package convert
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var reStyledTag = regexp.MustCompile(`<(/?)(wj|add|nd|bdit|i|b|span)>`)
+
+// ParseCsvFile reads a CSV written by this tool back into a Document.
+// Columns are found by header name, so extra columns and other column orders
+// are accepted. Book, Chapter and Verse are required, with TextStyled or
+// TextPlain for the text. A section heading is added wherever Subtitle
+// changes, and Footnotes and Crossrefs are read in any note mode.
+func ParseCsvFile(path string) (*Document, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	doc, err := parseCsv(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v in %s", err, path)
+	}
+	return doc, nil
+}
+
+func parseCsv(r io.Reader) (*Document, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	for _, name := range []string{"Book", "Chapter", "Verse"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV is missing the %s column", name)
+		}
+	}
+	_, hasStyled := columns["TextStyled"]
+	_, hasPlain := columns["TextPlain"]
+	if !hasStyled && !hasPlain {
+		return nil, fmt.Errorf("CSV is missing the TextStyled or TextPlain column")
+	}
+
+	b := newDocBuilder("csv")
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		b.csvRow(field, Position{Line: line, Column: 1})
+	}
+	return b.finish(), nil
+}
+
+// csvRow adds one CSV row, starting a new book or chapter when the row's
+// differs from the previous row's.
+func (b *docBuilder) csvRow(field func(name string) string, pos Position) {
+	code, chapter, verse := field("Book"), field("Chapter"), field("Verse")
+	if code == "" || chapter == "" || verse == "" {
+		b.warn(pos, "incomplete-row", "Row has no book, chapter, or verse and was skipped")
+		return
+	}
+
+	if b.book == nil || !strings.EqualFold(b.book.Code, code) {
+		b.startBook(code, pos)
+	}
+	if b.chapter == nil || b.chapter.Number != chapter {
+		b.startChapter(chapter, pos)
+	}
+	if subtitle := field("Subtitle"); subtitle != "" && subtitle != b.subtitle {
+		b.endVerse()
+		b.addHeading("s", subtitle)
+	}
+	if b.para == nil {
+		b.startParagraph("p")
+	}
+
+	b.startVerse(verse, pos)
+	if styled := field("TextStyled"); styled != "" {
+		b.addStyledText(styled)
+	} else {
+		b.addText(field("TextPlain"), nil)
+	}
+	for _, note := range parseNoteCell(field("Footnotes"), false) {
+		b.addNote(note)
+	}
+	for _, note := range parseNoteCell(field("Crossrefs"), true) {
+		b.addNote(note)
+	}
+}
+
+// addStyledText adds TextStyled markup as verse spans, mapping each tag back
+// to its character style.
+func (b *docBuilder) addStyledText(styled string) {
+	var styles []string
+	var tags []string
+	last := 0
+	for _, m := range reStyledTag.FindAllStringSubmatchIndex(styled, -1) {
+		b.addText(styled[last:m[0]], styles)
+		last = m[1]
+
+		closing, tag := styled[m[2]:m[3]] == "/", styled[m[4]:m[5]]
+		if !closing {
+			tags = append(tags, tag)
+			if style := styleForTagName(tag); style != "" {
+				styles = append(styles, style)
+			}
+			continue
+		}
+		for i := len(tags) - 1; i >= 0; i-- {
+			if tags[i] != tag {
+				continue
+			}
+			for _, t := range tags[i:] {
+				if styleForTagName(t) != "" {
+					styles = styles[:len(styles)-1]
+				}
+			}
+			tags = tags[:i]
+			break
+		}
+	}
+	b.addText(styled[last:], styles)
+}
@@ -0,0 +1,430 @@
+package convert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Document is the parsed form of a Scripture file. The USX and USFM parsers
+// both produce it and every output writer consumes it. Language and
+// Translation are set when the file came from a DBL bundle.
+type Document struct {
+	Format      string
+	Language    string
+	Translation string
+	Books       []*Book
+	Issues      []Issue
+}
+
+// Position is a 1-based line and column in the source file. It is zero for
+// formats that do not track positions.
+type Position struct {
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// Issue is a structural problem noticed while parsing or validating.
+type Issue struct {
+	Position
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Book holds one book. Paragraphs collects titles and introduction material
+// that appear before the first chapter.
+type Book struct {
+	Code       string
+	Paragraphs []*Paragraph
+	Chapters   []*Chapter
+}
+
+// Chapter keeps its paragraphs and verses in document order. A verse that
+// runs across several paragraphs is listed in the paragraph where it starts.
+type Chapter struct {
+	Number     string
+	Pos        Position
+	Paragraphs []*Paragraph
+	Verses     []*Verse
+}
+
+// Paragraph is a block-level element. Heading holds the text of section
+// headings and titles; body paragraphs list the verses that start in them.
+type Paragraph struct {
+	Style   string
+	Heading string
+	Verses  []*Verse
+}
+
+// Verse is the unit of output. Start, End and Segment are parsed from Number
+// ("1-2" has Start 1 and End 2, "3a" has Segment "a") and are zero when the
+// number cannot be parsed. Subtitle is the heading in effect when the verse
+// starts. Placeholder marks an empty verse added to fill a versification gap.
+type Verse struct {
+	Number      string
+	Start       int
+	End         int
+	Segment     string
+	Subtitle    string
+	Pos         Position
+	Placeholder bool
+	Spans       []Span
+	Notes       []*Note
+}
+
+// Span is a run of verse text with the character styles that enclose it,
+// outermost first.
+type Span struct {
+	Text   string
+	Styles []string
+}
+
+// Note is a footnote or cross reference attached to a verse. anchor is the
+// byte length of the verse's span text where the note appeared.
+type Note struct {
+	Style  string
+	Caller string
+	Parts  []NotePart
+	anchor int
+}
+
+// NotePart is one styled run inside a note, such as fr, ft or xt.
+type NotePart struct {
+	Style string
+	Text  string
+}
+
+func (n *Note) IsCrossref() bool {
+	return strings.HasPrefix(n.Style, "x")
+}
+
+// Text returns the first ft part, or for a cross reference the first ft or
+// xt part, which is what the CSV columns carry.
+func (n *Note) Text() string {
+	for _, part := range n.Parts {
+		if part.Style == "ft" || part.Style == "xt" && n.IsCrossref() {
+			return normalizeWhitespace(part.Text)
+		}
+	}
+	return ""
+}
+
+func (v *Verse) PlainText() string {
+	var b strings.Builder
+	for _, span := range v.Spans {
+		b.WriteString(span.Text)
+	}
+	return normalizeWhitespace(b.String())
+}
+
+func (v *Verse) StyledText() string {
+	return normalizeWhitespace(v.markupText(
+		func(style string, depth int) string { return "<" + getStyledTagName(style) + ">" },
+		func(style string, depth int) string { return "</" + getStyledTagName(style) + ">" },
+	))
+}
+
+// markupText writes the verse spans with the markup returned by open and
+// close around each styled run. depth is 0 for the outermost style. Spacing
+// around styled runs is kept outside the markup.
+func (v *Verse) markupText(open, close func(style string, depth int) string) string {
+	var b strings.Builder
+	var stack []string
+	pending := false
+
+	for _, span := range v.Spans {
+		core := strings.TrimSpace(span.Text)
+		if core == "" {
+			if span.Text != "" {
+				pending = true
+			}
+			continue
+		}
+		if strings.TrimLeftFunc(span.Text, unicode.IsSpace) != span.Text {
+			pending = true
+		}
+
+		keep := 0
+		for keep < len(stack) && keep < len(span.Styles) && stack[keep] == span.Styles[keep] {
+			keep++
+		}
+		for i := len(stack) - 1; i >= keep; i-- {
+			b.WriteString(close(stack[i], i))
+		}
+		stack = stack[:keep]
+		if pending {
+			b.WriteString(" ")
+			pending = false
+		}
+		for _, style := range span.Styles[keep:] {
+			b.WriteString(open(style, len(stack)))
+			stack = append(stack, style)
+		}
+		b.WriteString(core)
+		pending = strings.TrimRightFunc(span.Text, unicode.IsSpace) != span.Text
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteString(close(stack[i], i))
+	}
+	return b.String()
+}
+
+// noteOffset returns where note sits in PlainText, counted in characters.
+func (v *Verse) noteOffset(note *Note) int {
+	var b strings.Builder
+	for _, span := range v.Spans {
+		b.WriteString(span.Text)
+	}
+	raw := b.String()
+	if note.anchor < len(raw) {
+		raw = raw[:note.anchor]
+	}
+	offset := utf8.RuneCountInString(normalizeWhitespace(raw))
+	if offset > 0 && strings.TrimRightFunc(raw, unicode.IsSpace) != raw {
+		offset++
+	}
+	if plain := utf8.RuneCountInString(v.PlainText()); offset > plain {
+		offset = plain
+	}
+	return offset
+}
+
+func (v *Verse) Footnotes() []string {
+	return v.noteTexts(false)
+}
+
+func (v *Verse) Crossrefs() []string {
+	return v.noteTexts(true)
+}
+
+func (v *Verse) noteTexts(crossrefs bool) []string {
+	var texts []string
+	for _, note := range v.Notes {
+		if note.IsCrossref() != crossrefs {
+			continue
+		}
+		if text := note.Text(); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// layout returns the chapter's paragraphs for writing it out. Verses that no
+// paragraph lists, such as those before the first paragraph marker, are put
+// in a p paragraph at the start.
+func (c *Chapter) layout() []*Paragraph {
+	placed := map[*Verse]bool{}
+	for _, para := range c.Paragraphs {
+		for _, verse := range para.Verses {
+			placed[verse] = true
+		}
+	}
+	var loose []*Verse
+	for _, verse := range c.Verses {
+		if !placed[verse] {
+			loose = append(loose, verse)
+		}
+	}
+	if len(loose) == 0 {
+		return c.Paragraphs
+	}
+	return append([]*Paragraph{{Style: "p", Verses: loose}}, c.Paragraphs...)
+}
+
+func (d *Document) eachVerse(fn func(book *Book, chapter *Chapter, verse *Verse) error) error {
+	for _, book := range d.Books {
+		for _, chapter := range book.Chapters {
+			for _, verse := range chapter.Verses {
+				if err := fn(book, chapter, verse); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// eachRow visits the verses that produce an output row: those with a book,
+// chapter and verse number and either some plain text or the placeholder flag.
+func (d *Document) eachRow(fn func(book *Book, chapter *Chapter, verse *Verse) error) error {
+	return d.eachVerse(func(book *Book, chapter *Chapter, verse *Verse) error {
+		if book.Code == "" || chapter.Number == "" || verse.Number == "" {
+			return nil
+		}
+		if !verse.Placeholder && verse.PlainText() == "" {
+			return nil
+		}
+		return fn(book, chapter, verse)
+	})
+}
+
+func sortDocument(doc *Document) {
+	sort.SliceStable(doc.Books, func(i, j int) bool {
+		return compareBookCodes(doc.Books[i].Code, doc.Books[j].Code) < 0
+	})
+	for _, book := range doc.Books {
+		sort.SliceStable(book.Chapters, func(i, j int) bool {
+			return parseInt(book.Chapters[i].Number) < parseInt(book.Chapters[j].Number)
+		})
+		for _, chapter := range book.Chapters {
+			verses := chapter.Verses
+			sort.SliceStable(verses, func(i, j int) bool {
+				return compareVerseNumbers(verses[i].Number, verses[j].Number) < 0
+			})
+		}
+	}
+}
+
+type docBuilder struct {
+	doc      *Document
+	book     *Book
+	chapter  *Chapter
+	para     *Paragraph
+	verse    *Verse
+	subtitle string
+}
+
+func newDocBuilder(format string) *docBuilder {
+	return &docBuilder{doc: &Document{Format: format}}
+}
+
+func (b *docBuilder) startBook(code string, pos Position) {
+	b.endVerse()
+	if code != "" {
+		code = b.checkBookCode(code, pos)
+	}
+	b.book = &Book{Code: code}
+	b.doc.Books = append(b.doc.Books, b.book)
+	b.chapter = nil
+	b.para = nil
+	b.subtitle = ""
+}
+
+func (b *docBuilder) startChapter(number string, pos Position) {
+	b.endVerse()
+	if b.book == nil {
+		b.startBook("", Position{})
+	}
+	b.chapter = &Chapter{Number: number, Pos: pos}
+	b.book.Chapters = append(b.book.Chapters, b.chapter)
+	b.para = nil
+}
+
+func (b *docBuilder) endChapter() {
+	b.endVerse()
+	b.chapter = nil
+	b.para = nil
+}
+
+func (b *docBuilder) startParagraph(style string) {
+	b.para = &Paragraph{Style: style}
+	b.appendParagraph(b.para)
+	if b.verse != nil {
+		b.verse.Spans = append(b.verse.Spans, Span{Text: " "})
+	}
+}
+
+func (b *docBuilder) endParagraph() {
+	b.para = nil
+}
+
+func (b *docBuilder) addHeading(style, text string) {
+	b.appendParagraph(&Paragraph{Style: style, Heading: text})
+	b.para = nil
+	if text != "" {
+		b.subtitle = text
+	}
+}
+
+func (b *docBuilder) appendParagraph(p *Paragraph) {
+	switch {
+	case b.chapter != nil:
+		b.chapter.Paragraphs = append(b.chapter.Paragraphs, p)
+	case b.book != nil:
+		b.book.Paragraphs = append(b.book.Paragraphs, p)
+	}
+}
+
+func (b *docBuilder) startVerse(number string, pos Position) {
+	b.endVerse()
+	if b.chapter == nil {
+		return
+	}
+	vn := parseVerseNumber(number)
+	b.verse = &Verse{
+		Number:   number,
+		Start:    vn.start,
+		End:      vn.end,
+		Segment:  vn.segment,
+		Subtitle: b.subtitle,
+		Pos:      pos,
+	}
+	b.chapter.Verses = append(b.chapter.Verses, b.verse)
+	if b.para != nil {
+		b.para.Verses = append(b.para.Verses, b.verse)
+	}
+}
+
+func (b *docBuilder) endVerse() {
+	b.verse = nil
+}
+
+func (b *docBuilder) addText(text string, styles []string) {
+	if b.verse == nil || text == "" {
+		return
+	}
+	spans := b.verse.Spans
+	if n := len(spans); n > 0 && sameStyles(spans[n-1].Styles, styles) {
+		spans[n-1].Text += text
+		return
+	}
+	b.verse.Spans = append(spans, Span{Text: text, Styles: append([]string(nil), styles...)})
+}
+
+func (b *docBuilder) addNote(note *Note) {
+	if b.verse == nil || note == nil {
+		return
+	}
+	for _, span := range b.verse.Spans {
+		note.anchor += len(span.Text)
+	}
+	b.verse.Notes = append(b.verse.Notes, note)
+}
+
+// checkBookCode upper-cases standard book codes and warns about codes that
+// are not in the book table, which are kept as written.
+func (b *docBuilder) checkBookCode(code string, pos Position) string {
+	if resolved := resolveBookCode(code); bookNumber(resolved) > 0 {
+		return resolved
+	}
+	message := fmt.Sprintf("Unknown book code %s", code)
+	if suggestion := suggestBookCode(code); suggestion != "" {
+		message += fmt.Sprintf(" (did you mean %s?)", suggestion)
+	}
+	b.warn(pos, "unknown-book-code", message)
+	return code
+}
+
+func (b *docBuilder) warn(pos Position, code, message string) {
+	b.doc.Issues = append(b.doc.Issues, Issue{Position: pos, Code: code, Message: message})
+}
+
+func (b *docBuilder) finish() *Document {
+	b.endVerse()
+	return b.doc
+}
+
+func sameStyles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
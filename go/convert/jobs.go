@@ -0,0 +1,67 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+var progressMu sync.Mutex
+
+// progressf writes one progress line to stderr. Workers share stderr, so
+// lines are serialized to keep them from interleaving.
+func progressf(opts Options, format string, args ...any) {
+	if opts.Quiet {
+		return
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+func jobCount(opts Options, n int) int {
+	jobs := opts.Jobs
+	if jobs > n {
+		jobs = n
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	return jobs
+}
+
+// runJobs calls fn for each index in [0, n) on up to jobs goroutines. Once a
+// call fails no new indexes are started, and the error with the lowest index
+// is returned so the outcome does not depend on scheduling.
+func runJobs(n, jobs int, fn func(i int) error) error {
+	errs := make([]error, n)
+	var next int64 = -1
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !failed.Load() {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				if err := fn(i); err != nil {
+					errs[i] = err
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
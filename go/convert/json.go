@@ -0,0 +1,90 @@
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+)
+
+type jsonVerse struct {
+	Book        string `json:"book"`
+	Chapter     string `json:"chapter"`
+	Verse       string `json:"verse"`
+	TextPlain   string `json:"textPlain"`
+	TextStyled  string `json:"textStyled"`
+	Footnotes   []any  `json:"footnotes"`
+	Crossrefs   []any  `json:"crossrefs"`
+	Subtitle    string `json:"subtitle"`
+	VerseStart  int    `json:"verseStart,omitempty"`
+	VerseEnd    int    `json:"verseEnd,omitempty"`
+	Segment     string `json:"segment,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Translation string `json:"translation,omitempty"`
+}
+
+func writeJSON(path string, doc *Document, lines bool, noteMode string) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if !lines {
+		w.WriteString("[")
+	}
+
+	rows := 0
+	err = doc.eachRow(func(book *Book, chapter *Chapter, verse *Verse) error {
+		data, err := marshalJSONCompact(jsonVerse{
+			Book:        book.Code,
+			Chapter:     chapter.Number,
+			Verse:       verse.Number,
+			TextPlain:   verse.PlainText(),
+			TextStyled:  verse.StyledText(),
+			Footnotes:   verse.notesFor(false, noteMode),
+			Crossrefs:   verse.notesFor(true, noteMode),
+			Subtitle:    verse.Subtitle,
+			VerseStart:  verse.Start,
+			VerseEnd:    verse.End,
+			Segment:     verse.Segment,
+			Language:    doc.Language,
+			Translation: doc.Translation,
+		})
+		if err != nil {
+			return err
+		}
+		switch {
+		case lines:
+		case rows == 0:
+			w.WriteString("\n  ")
+		default:
+			w.WriteString(",\n  ")
+		}
+		w.Write(data)
+		if lines {
+			w.WriteString("\n")
+		}
+		rows++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if !lines {
+		w.WriteString("\n]\n")
+	}
+	return rows, w.Flush()
+}
+
+func marshalJSONCompact(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// MergeResult describes the single CSV written in merge mode.
+type MergeResult struct {
+	Output string   `json:"output"`
+	Notes  string   `json:"notes,omitempty"`
+	Rows   int      `json:"rows"`
+	Books  []string `json:"books"`
+}
+
+type mergeBook struct {
+	doc  *Document
+	book *Book
+}
+
+func convertMerged(paths []string, opts Options) (Summary, error) {
+	if outputFormat(opts) != OutputCSV {
+		return Summary{}, errors.New("Merge output supports only the csv format.")
+	}
+	if opts.Parallel {
+		return Summary{}, errors.New("Merge and parallel output cannot be combined.")
+	}
+	for _, path := range paths {
+		if samePath(opts.Merge, path) {
+			return Summary{}, fmt.Errorf("Output would overwrite input: %s", path)
+		}
+	}
+
+	docs, results, err := loadDocuments(paths, opts)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	var books []mergeBook
+	withMeta := false
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		withMeta = withMeta || hasCsvMeta(doc)
+		for _, book := range doc.Books {
+			books = append(books, mergeBook{doc: doc, book: book})
+		}
+	}
+	sort.SliceStable(books, func(i, j int) bool {
+		return compareBookCodes(books[i].book.Code, books[j].book.Code) < 0
+	})
+
+	if dir := filepath.Dir(opts.Merge); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return Summary{}, err
+		}
+	}
+	merged, err := writeMergedCsv(opts.Merge, books, withMeta, opts.NoteMode)
+	if err != nil {
+		return Summary{}, err
+	}
+	progressf(opts, "Created CSV: %s", opts.Merge)
+
+	if opts.NotesCSV {
+		notesDoc := &Document{}
+		for _, mb := range books {
+			notesDoc.Books = append(notesDoc.Books, mb.book)
+		}
+		merged.Notes = notesPath(opts.Merge)
+		if _, err := writeNotesCsv(merged.Notes, notesDoc); err != nil {
+			return Summary{}, err
+		}
+		progressf(opts, "Created notes CSV: %s", merged.Notes)
+	}
+
+	for i := range results {
+		if results[i].Status == StatusOK {
+			results[i].Output = opts.Merge
+		}
+	}
+	return Summary{Files: results, Failed: countFailed(results), Merged: &merged}, nil
+}
+
+// writeMergedCsv writes every book's rows under one header, with BookNumber
+// after Book so a whole canon can be filtered and sorted in a spreadsheet.
+func writeMergedCsv(path string, books []mergeBook, withMeta bool, noteMode string) (MergeResult, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	header := append([]string{"Book", "BookNumber"}, csvHeader[1:]...)
+	if withMeta {
+		header = append(header, csvMetaHeader...)
+	}
+	if err := writer.Write(header); err != nil {
+		return MergeResult{}, err
+	}
+
+	result := MergeResult{Output: path, Books: []string{}}
+	for _, mb := range books {
+		doc := &Document{Books: []*Book{mb.book}}
+		number := formatVerseInt(bookNumber(mb.book.Code))
+		rows := 0
+		err := doc.eachRow(func(book *Book, chapter *Chapter, verse *Verse) error {
+			rows++
+			record := csvRecord(mb.doc, book, chapter, verse, withMeta, noteMode)
+			record = append([]string{record[0], number}, record[1:]...)
+			return writer.Write(record)
+		})
+		if err != nil {
+			return MergeResult{}, err
+		}
+		if rows > 0 {
+			result.Books = append(result.Books, mb.book.Code)
+			result.Rows += rows
+		}
+	}
+	writer.Flush()
+	return result, writer.Error()
+}
@@ -0,0 +1,189 @@
+package convert
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	CollisionFail   = "fail"
+	CollisionRename = "rename"
+)
+
+var reNamePlaceholder = regexp.MustCompile(`\{(\w+)\}`)
+
+var namePlaceholders = map[string]bool{
+	"dir":      true,
+	"input":    true,
+	"book":     true,
+	"bookNum":  true,
+	"language": true,
+	"format":   true,
+}
+
+func validateCollisionMode(mode string) error {
+	switch mode {
+	case "", CollisionFail, CollisionRename:
+		return nil
+	default:
+		return fmt.Errorf("Unknown collision mode: %s (use fail or rename)", mode)
+	}
+}
+
+func validateNameTemplate(template string) error {
+	for _, m := range reNamePlaceholder.FindAllStringSubmatch(template, -1) {
+		if !namePlaceholders[m[1]] {
+			return fmt.Errorf("Unknown name template placeholder: %s", m[0])
+		}
+	}
+	return nil
+}
+
+// planOutputs works out every output path before anything is written, so two
+// inputs that would produce the same file are caught up front. In rename mode
+// later inputs get a numeric suffix instead.
+func planOutputs(paths []string, outputFolder string, opts Options) ([]string, error) {
+	if err := validateCollisionMode(opts.OnCollision); err != nil {
+		return nil, err
+	}
+	if err := validateNameTemplate(opts.NameTemplate); err != nil {
+		return nil, err
+	}
+
+	outputs := make([]string, len(paths))
+	owners := map[string]int{}
+	for i, path := range paths {
+		out := outputPath(path, outputFolder, opts)
+		if j, ok := owners[collisionKey(out)]; ok {
+			if opts.OnCollision != CollisionRename {
+				return nil, fmt.Errorf("Output collision: %s and %s would both write %s", paths[j], path, out)
+			}
+			out = disambiguate(out, owners)
+		}
+		owners[collisionKey(out)] = i
+		outputs[i] = out
+	}
+	return outputs, nil
+}
+
+// collisionKey folds case so that names differing only in case also collide,
+// as they would on Windows and macOS.
+func collisionKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return strings.ToLower(path)
+}
+
+func disambiguate(path string, taken map[string]int) string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		candidate := stem + "_" + strconv.Itoa(n) + ext
+		if _, ok := taken[collisionKey(candidate)]; !ok {
+			return candidate
+		}
+	}
+}
+
+func outputPath(inputPath, outputFolder string, opts Options) string {
+	dir := filepath.Dir(inputPath)
+	if bundle := bundleFor(inputPath, opts.Bundles); bundle != nil {
+		dir = bundle.outputDir(outputFolder, opts.InputRoots)
+	} else if outputFolder != "" {
+		dir = filepath.Join(outputFolder, mirroredDir(inputPath, opts.InputRoots))
+	}
+	format := outputFormat(opts)
+	name := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath)) + "." + format
+	if opts.NameTemplate != "" {
+		book, language := "", opts.Language
+		if project, projectBook := projectFor(inputPath, opts.Projects); project != nil {
+			book = projectBook.Code
+			if language == "" {
+				language = project.Language
+			}
+		} else if strings.Contains(opts.NameTemplate, "{book") {
+			book = parsedBookCode(inputPath)
+		}
+		if bundle := bundleFor(inputPath, opts.Bundles); bundle != nil && language == "" {
+			language = bundle.Language
+		}
+		name = expandNameTemplate(opts.NameTemplate, inputPath, format, book, language)
+	}
+	return filepath.Join(dir, name)
+}
+
+// mirroredDir returns the folder of inputPath relative to the input root that
+// contains it, so outputs under -output keep the input tree's layout.
+func mirroredDir(inputPath string, roots []string) string {
+	absInput, err := filepath.Abs(inputPath)
+	if err != nil {
+		return ""
+	}
+	best := ""
+	for _, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil || !strings.HasPrefix(absInput, absRoot+string(filepath.Separator)) {
+			continue
+		}
+		if len(absRoot) > len(best) {
+			best = absRoot
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(best, filepath.Dir(absInput))
+	if err != nil || rel == "." {
+		return ""
+	}
+	return rel
+}
+
+func expandNameTemplate(template, inputPath, format, book, language string) string {
+	input := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	name := reNamePlaceholder.ReplaceAllStringFunc(template, func(m string) string {
+		switch m[1 : len(m)-1] {
+		case "dir":
+			return filepath.Base(filepath.Dir(inputPath))
+		case "input":
+			return input
+		case "book":
+			if book != "" {
+				return book
+			}
+			return input
+		case "bookNum":
+			if num := bookFileNumber(book); num != "" {
+				return num
+			}
+			return "00"
+		case "language":
+			if language != "" {
+				return language
+			}
+			return "und"
+		case "format":
+			return format
+		}
+		return m
+	})
+	if filepath.Ext(name) == "" {
+		name += "." + format
+	}
+	return name
+}
+
+// parsedBookCode parses the file and returns its first book's code, so that
+// {book} is exactly what the Book column holds. It returns "" when the file
+// cannot be parsed or has no book.
+func parsedBookCode(path string) string {
+	doc, err := ParseFile(path)
+	if err != nil || len(doc.Books) == 0 {
+		return ""
+	}
+	return doc.Books[0].Code
+}
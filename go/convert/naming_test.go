@@ -0,0 +1,34 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsedBookCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{name: "standard code", file: "book.usfm", content: "\\id mat English\n\\c 1\n", want: "MAT"},
+		{name: "unknown code kept whole", file: "book.usfm", content: "\\id mat1\n\\c 1\n", want: "mat1"},
+		{name: "no id uses file name", file: "41MATWEB.SFM", content: "\\c 1\n\\p\n\\v 1 text\n", want: "MAT"},
+		{name: "usx code", file: "book.usx", content: `<usx version="3.0"><book code="JHN" style="id"/></usx>`, want: "JHN"},
+		{name: "usj book node", file: "book.usj", content: `{"type":"USJ","version":"3.0","meta":{"code":"XYZ"},"content":[{"type":"book","marker":"id","code":"JHN"}]}`, want: "JHN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := parsedBookCode(path); got != tt.want {
+				t.Errorf("parsedBookCode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package convert
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	NoteFtOnly     = "ft-only"
+	NoteFull       = "full"
+	NoteStructured = "structured"
+)
+
+// NoteDetail is a note as written in the structured note mode. Reference is
+// the \fr or \xo part and Keyword the \fk or \xk part; Text joins the rest.
+type NoteDetail struct {
+	Caller    string `json:"caller"`
+	Reference string `json:"reference,omitempty"`
+	Keyword   string `json:"keyword,omitempty"`
+	Text      string `json:"text"`
+}
+
+func validateNoteMode(mode string) error {
+	switch mode {
+	case "", NoteFtOnly, NoteFull, NoteStructured:
+		return nil
+	default:
+		return fmt.Errorf("Unknown note mode: %s (use ft-only, full, or structured)", mode)
+	}
+}
+
+// FullText returns the text of every part of the note in order, so \fr, \fq,
+// \fk and later \ft runs are kept.
+func (n *Note) FullText() string {
+	var texts []string
+	for _, part := range n.Parts {
+		if text := normalizeWhitespace(part.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+func (n *Note) Detail() NoteDetail {
+	detail := NoteDetail{Caller: n.Caller}
+	var texts []string
+	for _, part := range n.Parts {
+		text := normalizeWhitespace(part.Text)
+		if text == "" {
+			continue
+		}
+		switch part.Style {
+		case "fr", "xo":
+			detail.Reference = joinNoteText(detail.Reference, text)
+		case "fk", "xk":
+			detail.Keyword = joinNoteText(detail.Keyword, text)
+		default:
+			texts = append(texts, text)
+		}
+	}
+	detail.Text = strings.Join(texts, " ")
+	return detail
+}
+
+func joinNoteText(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + " " + b
+}
+
+// notesFor returns the verse's footnotes or cross references in the given
+// mode: strings for ft-only and full, NoteDetail values for structured.
+// Notes with nothing to show in the mode are left out.
+func (v *Verse) notesFor(crossrefs bool, mode string) []any {
+	values := []any{}
+	for _, note := range v.Notes {
+		if note.IsCrossref() != crossrefs {
+			continue
+		}
+		switch mode {
+		case NoteFull:
+			if text := note.FullText(); text != "" {
+				values = append(values, text)
+			}
+		case NoteStructured:
+			if detail := note.Detail(); detail.Reference != "" || detail.Keyword != "" || detail.Text != "" {
+				values = append(values, detail)
+			}
+		default:
+			if text := note.Text(); text != "" {
+				values = append(values, text)
+			}
+		}
+	}
+	return values
+}
+
+// noteCell formats notes for a CSV cell: joined with " | ", or as a JSON
+// array in the structured mode.
+func (v *Verse) noteCell(crossrefs bool, mode string) string {
+	values := v.notesFor(crossrefs, mode)
+	if len(values) == 0 {
+		return ""
+	}
+	if mode == NoteStructured {
+		data, err := marshalJSONCompact(values)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+	texts := make([]string, len(values))
+	for i, value := range values {
+		texts[i] = value.(string)
+	}
+	return strings.Join(texts, " | ")
+}
+
+// parseNoteCell reads a Footnotes or Crossrefs cell back into notes. A JSON
+// array from the structured mode keeps the caller, reference and keyword;
+// any other cell is split on " | " into notes with one \ft or \xt part.
+func parseNoteCell(value string, crossrefs bool) []*Note {
+	style, caller, refStyle, keyStyle, textStyle := "f", "+", "fr", "fk", "ft"
+	if crossrefs {
+		style, caller, refStyle, keyStyle, textStyle = "x", "-", "xo", "xk", "xt"
+	}
+
+	var details []NoteDetail
+	if strings.HasPrefix(value, "[") && json.Unmarshal([]byte(value), &details) == nil {
+		var notes []*Note
+		for _, detail := range details {
+			note := &Note{Style: style, Caller: detail.Caller}
+			if note.Caller == "" {
+				note.Caller = caller
+			}
+			for _, part := range []NotePart{{refStyle, detail.Reference}, {keyStyle, detail.Keyword}, {textStyle, detail.Text}} {
+				if part.Text != "" {
+					note.Parts = append(note.Parts, part)
+				}
+			}
+			notes = append(notes, note)
+		}
+		return notes
+	}
+
+	var notes []*Note
+	for _, text := range strings.Split(value, " | ") {
+		if text = strings.TrimSpace(text); text != "" {
+			notes = append(notes, &Note{Style: style, Caller: caller, Parts: []NotePart{{Style: textStyle, Text: text}}})
+		}
+	}
+	return notes
+}
+
+var notesCsvHeader = []string{"Book", "Chapter", "Verse", "NoteType", "Caller", "Reference", "Text", "Offset"}
+
+// notesPath is where the notes table for an output goes: MAT.csv gets
+// MAT.notes.csv next to it.
+func notesPath(outPath string) string {
+	return strings.TrimSuffix(outPath, filepath.Ext(outPath)) + ".notes.csv"
+}
+
+// writeNotesCsv writes one row per footnote and cross reference of the
+// verses that produce output rows. Offset is the number of TextPlain
+// characters before the note, so note markers can be put back in place.
+func writeNotesCsv(path string, doc *Document) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(notesCsvHeader); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	err = doc.eachRow(func(book *Book, chapter *Chapter, verse *Verse) error {
+		for _, note := range verse.Notes {
+			detail := note.Detail()
+			text := joinNoteText(detail.Keyword, detail.Text)
+			if detail.Reference == "" && text == "" {
+				continue
+			}
+			rows++
+			record := []string{
+				book.Code,
+				chapter.Number,
+				verse.Number,
+				note.Style,
+				note.Caller,
+				detail.Reference,
+				text,
+				strconv.Itoa(verse.noteOffset(note)),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	writer.Flush()
+	return rows, writer.Error()
+}
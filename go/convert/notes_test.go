@@ -0,0 +1,53 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNoteCell(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		crossrefs bool
+		want      []NotePart
+	}{
+		{
+			name:  "footnote",
+			value: `[{"caller":"+","reference":"1.1","keyword":"word","text":"note"}]`,
+			want:  []NotePart{{"fr", "1.1"}, {"fk", "word"}, {"ft", "note"}},
+		},
+		{
+			name:      "cross reference",
+			value:     `[{"caller":"-","reference":"1.1","text":"Luke 3:1"}]`,
+			crossrefs: true,
+			want:      []NotePart{{"xo", "1.1"}, {"xt", "Luke 3:1"}},
+		},
+		{
+			name:  "ft-only footnote",
+			value: "note",
+			want:  []NotePart{{"ft", "note"}},
+		},
+		{
+			name:      "ft-only cross reference",
+			value:     "Mk 1:1",
+			crossrefs: true,
+			want:      []NotePart{{"xt", "Mk 1:1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notes := parseNoteCell(tt.value, tt.crossrefs)
+			if len(notes) != 1 {
+				t.Fatalf("notes = %d, want 1", len(notes))
+			}
+			if !reflect.DeepEqual(notes[0].Parts, tt.want) {
+				t.Errorf("parts = %v, want %v", notes[0].Parts, tt.want)
+			}
+			if got, want := notes[0].Text(), tt.want[len(tt.want)-1].Text; got != want {
+				t.Errorf("Text() = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package convert
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParallelResult describes one aligned CSV. Missing lists, per translation
+// label, the "chapter:verse" keys present in another translation but absent
+// from that one.
+type ParallelResult struct {
+	Book    string              `json:"book"`
+	Output  string              `json:"output"`
+	Rows    int                 `json:"rows"`
+	Labels  []string            `json:"labels"`
+	Missing map[string][]string `json:"missing"`
+}
+
+type parallelSource struct {
+	label string
+	path  string
+	book  *Book
+}
+
+type parallelKey struct {
+	chapter string
+	verse   string
+}
+
+func convertParallel(paths []string, outputFolder string, opts Options) (Summary, error) {
+	if outputFormat(opts) != OutputCSV {
+		return Summary{}, errors.New("Parallel output supports only the csv format.")
+	}
+	if opts.NotesCSV {
+		return Summary{}, errors.New("A notes CSV cannot be combined with parallel output.")
+	}
+	if len(opts.Labels) > 0 && len(opts.Labels) != len(paths) {
+		return Summary{}, fmt.Errorf("Expected %d parallel labels, got %d", len(paths), len(opts.Labels))
+	}
+
+	docs, results, err := loadDocuments(paths, opts)
+	if err != nil {
+		return Summary{}, err
+	}
+	runSummary := Summary{Files: results}
+	groups := map[string][]parallelSource{}
+	var bookOrder []string
+	fileBooks := make([][]string, len(paths))
+
+	for i, path := range paths {
+		doc := docs[i]
+		if doc == nil {
+			continue
+		}
+		label := parallelLabel(path, opts)
+		if len(opts.Labels) > 0 {
+			label = opts.Labels[i]
+		}
+
+		for _, book := range doc.Books {
+			code := strings.ToUpper(book.Code)
+			if _, ok := groups[code]; !ok {
+				bookOrder = append(bookOrder, code)
+			}
+			groups[code] = append(groups[code], parallelSource{label: label, path: path, book: book})
+			fileBooks[i] = append(fileBooks[i], code)
+		}
+	}
+
+	sort.SliceStable(bookOrder, func(i, j int) bool {
+		return compareBookCodes(bookOrder[i], bookOrder[j]) < 0
+	})
+	outputs := map[string]string{}
+	for _, code := range bookOrder {
+		sources := groups[code]
+		dir := outputFolder
+		if dir == "" {
+			dir = filepath.Dir(sources[0].path)
+		}
+		outPath := filepath.Join(dir, code+"_parallel.csv")
+		result, err := writeParallelCsv(outPath, code, sources, opts.PreserveOrder)
+		if err != nil {
+			return Summary{}, err
+		}
+		outputs[code] = outPath
+		runSummary.Parallel = append(runSummary.Parallel, result)
+
+		for _, label := range result.Labels {
+			if n := len(result.Missing[label]); n > 0 {
+				progressf(opts, "Parallel %s: %s is missing %d verse(s)", code, label, n)
+			}
+		}
+		progressf(opts, "Created CSV: %s", outPath)
+	}
+
+	for i := range runSummary.Files {
+		if books := fileBooks[i]; len(books) > 0 {
+			runSummary.Files[i].Output = outputs[books[0]]
+		}
+	}
+	runSummary.Failed = countFailed(runSummary.Files)
+	return runSummary, nil
+}
+
+// parallelLabel names a translation after its DBL bundle or Paratext
+// project, or else after the folder holding the file, since parallel inputs
+// usually share book file names.
+func parallelLabel(path string, opts Options) string {
+	if bundle := bundleFor(path, opts.Bundles); bundle != nil {
+		return bundle.Label()
+	}
+	if project, _ := projectFor(path, opts.Projects); project != nil {
+		return project.Name
+	}
+	dir := filepath.Base(filepath.Dir(path))
+	if dir == "." || dir == string(filepath.Separator) {
+		return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return dir
+}
+
+func writeParallelCsv(path, code string, sources []parallelSource, preserveOrder bool) (ParallelResult, error) {
+	labels := make([]string, len(sources))
+	used := map[string]int{}
+	for i, src := range sources {
+		label := src.label
+		used[label]++
+		if used[label] > 1 {
+			label += "_" + strconv.Itoa(used[label])
+		}
+		labels[i] = label
+	}
+
+	var keys []parallelKey
+	seen := map[parallelKey]bool{}
+	texts := make([]map[parallelKey]string, len(sources))
+	for i, src := range sources {
+		texts[i] = map[parallelKey]string{}
+		for _, chapter := range src.book.Chapters {
+			for _, verse := range chapter.Verses {
+				plain := verse.PlainText()
+				if chapter.Number == "" || verse.Number == "" || (plain == "" && !verse.Placeholder) {
+					continue
+				}
+				key := parallelKey{chapter: chapter.Number, verse: verse.Number}
+				texts[i][key] = plain
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	if !preserveOrder {
+		sort.SliceStable(keys, func(i, j int) bool {
+			if ci, cj := parseInt(keys[i].chapter), parseInt(keys[j].chapter); ci != cj {
+				return ci < cj
+			}
+			return compareVerseNumbers(keys[i].verse, keys[j].verse) < 0
+		})
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return ParallelResult{}, err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	header := []string{"Book", "Chapter", "Verse"}
+	for _, label := range labels {
+		header = append(header, "TextPlain_"+label)
+	}
+	if err := writer.Write(header); err != nil {
+		return ParallelResult{}, err
+	}
+
+	result := ParallelResult{Book: code, Output: path, Labels: labels, Missing: map[string][]string{}}
+	for _, label := range labels {
+		result.Missing[label] = []string{}
+	}
+	for _, key := range keys {
+		record := []string{code, key.chapter, key.verse}
+		for i, label := range labels {
+			text, ok := texts[i][key]
+			if !ok {
+				result.Missing[label] = append(result.Missing[label], key.chapter+":"+key.verse)
+			}
+			record = append(record, text)
+		}
+		if err := writer.Write(record); err != nil {
+			return ParallelResult{}, err
+		}
+		result.Rows++
+	}
+	writer.Flush()
+	return result, writer.Error()
+}
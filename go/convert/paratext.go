@@ -0,0 +1,258 @@
+package convert
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Project is a Paratext project folder described by its Settings.xml. Books
+// lists the book files found through the project's naming pattern, in canon
+// order.
+type Project struct {
+	Dir               string     `json:"dir"`
+	Name              string     `json:"name"`
+	FullName          string     `json:"fullName,omitempty"`
+	Language          string     `json:"language,omitempty"`
+	Encoding          string     `json:"encoding"`
+	Versification     string     `json:"versification,omitempty"`
+	VersificationFile string     `json:"versificationFile,omitempty"`
+	Books             []BookFile `json:"books"`
+
+	versification *Versification
+}
+
+type BookFile struct {
+	Code string `json:"code"`
+	Path string `json:"path"`
+}
+
+type paratextSettings struct {
+	Name            string `xml:"Name"`
+	FullName        string `xml:"FullName"`
+	Encoding        string `xml:"Encoding"`
+	LanguageIsoCode string `xml:"LanguageIsoCode"`
+	Versification   string `xml:"Versification"`
+	Naming          struct {
+		PrePart      string `xml:"PrePart,attr"`
+		PostPart     string `xml:"PostPart,attr"`
+		BookNameForm string `xml:"BookNameForm,attr"`
+	} `xml:"Naming"`
+}
+
+// paratextSchemes maps the Versification numbers used in Settings.xml to
+// scheme names and the file names Paratext ships them under.
+var paratextSchemes = map[string][2]string{
+	"1": {"Original", "org.vrs"},
+	"2": {"Septuagint", "lxx.vrs"},
+	"3": {"Vulgate", "vul.vrs"},
+	"4": {"English", "eng.vrs"},
+	"5": {"RussianProtestant", "rsc.vrs"},
+	"6": {"RussianOrthodox", "rso.vrs"},
+}
+
+// IsProjectDir reports whether dir holds a Paratext Settings.xml.
+func IsProjectDir(dir string) bool {
+	return isFile(filepath.Join(dir, "Settings.xml"))
+}
+
+// LoadProject reads a Paratext project's Settings.xml and finds its book
+// files. The .vrs file for the project's versification is looked up in the
+// project folder and then in vrsDir; a custom.vrs in the project folder is
+// applied on top of it.
+func LoadProject(dir, vrsDir string) (*Project, error) {
+	settingsPath := filepath.Join(dir, "Settings.xml")
+	data, err := os.ReadFile(settingsPath)
+	if err != nil {
+		return nil, err
+	}
+	var settings paratextSettings
+	if err := xml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("Invalid Settings.xml in %s: %v", dir, err)
+	}
+
+	p := &Project{
+		Dir:      dir,
+		Name:     settings.Name,
+		FullName: settings.FullName,
+		Encoding: strings.TrimSpace(settings.Encoding),
+	}
+	if p.Name == "" {
+		p.Name = filepath.Base(dir)
+	}
+	if p.Encoding == "" {
+		p.Encoding = "65001"
+	}
+	if _, err := decodeCodePage(nil, p.Encoding); err != nil {
+		return nil, fmt.Errorf("%v in %s", err, settingsPath)
+	}
+	p.Language, _, _ = strings.Cut(strings.TrimSpace(settings.LanguageIsoCode), ":")
+
+	if err := p.findBooks(settings); err != nil {
+		return nil, err
+	}
+	if err := p.loadVersification(strings.TrimSpace(settings.Versification), vrsDir); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Project) findBooks(settings paratextSettings) error {
+	entries, err := os.ReadDir(p.Dir)
+	if err != nil {
+		return err
+	}
+	files := map[string]string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files[strings.ToLower(entry.Name())] = entry.Name()
+		}
+	}
+
+	form := settings.Naming.BookNameForm
+	if form == "" {
+		form = "41MAT"
+	}
+	for _, code := range bookIDs {
+		part := strings.NewReplacer("41", bookFileNumber(code), "MAT", code).Replace(form)
+		name := settings.Naming.PrePart + part + settings.Naming.PostPart
+		if actual, ok := files[strings.ToLower(name)]; ok {
+			p.Books = append(p.Books, BookFile{Code: code, Path: filepath.Join(p.Dir, actual)})
+		}
+	}
+	return nil
+}
+
+func (p *Project) loadVersification(setting, vrsDir string) error {
+	scheme, ok := paratextSchemes[setting]
+	if !ok {
+		if setting == "" {
+			return nil
+		}
+		scheme = [2]string{setting, strings.ToLower(setting) + ".vrs"}
+	}
+	p.Versification = scheme[0]
+
+	for _, dir := range []string{p.Dir, vrsDir} {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, scheme[1])
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		v, err := LoadVersification(path)
+		if err != nil {
+			return err
+		}
+		p.versification = v
+		p.VersificationFile = path
+		break
+	}
+	if p.versification == nil {
+		return nil
+	}
+
+	customPath := filepath.Join(p.Dir, "custom.vrs")
+	if _, err := os.Stat(customPath); err != nil {
+		return nil
+	}
+	custom, err := LoadVersification(customPath)
+	if err != nil {
+		return err
+	}
+	p.versification.overlay(custom)
+	return nil
+}
+
+func (p *Project) book(path string) *BookFile {
+	for i := range p.Books {
+		if samePath(p.Books[i].Path, path) {
+			return &p.Books[i]
+		}
+	}
+	return nil
+}
+
+func (p *Project) parseBook(book *BookFile) (*Document, error) {
+	data, err := os.ReadFile(book.Path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := decodeCodePage(data, p.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	return parseUsfm(content, "usfm", book.Code), nil
+}
+
+// projectFor returns the project that owns path, if any.
+func projectFor(path string, projects []*Project) (*Project, *BookFile) {
+	for _, p := range projects {
+		if book := p.book(path); book != nil {
+			return p, book
+		}
+	}
+	return nil, nil
+}
+
+// parseInput parses a project book with its project's encoding, and any other
+// file by extension.
+func parseInput(path string, projects []*Project) (*Document, error) {
+	if p, book := projectFor(path, projects); p != nil {
+		return p.parseBook(book)
+	}
+	return ParseFile(path)
+}
+
+// decodeCodePage converts file bytes in a Windows code page to a string. Only
+// the code pages Paratext projects commonly use are supported.
+func decodeCodePage(data []byte, codePage string) (string, error) {
+	switch codePage {
+	case "65001":
+		data = trimUtf8Bom(data)
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("File is not valid UTF-8")
+		}
+		return string(data), nil
+	case "1252":
+		var b strings.Builder
+		for _, c := range data {
+			if c >= 0x80 && c < 0xA0 {
+				b.WriteRune(cp1252[c-0x80])
+				continue
+			}
+			b.WriteRune(rune(c))
+		}
+		return b.String(), nil
+	case "28591":
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+		}
+		return string(runes), nil
+	default:
+		if _, err := strconv.Atoi(codePage); err != nil {
+			return "", fmt.Errorf("Invalid encoding %q", codePage)
+		}
+		return "", fmt.Errorf("Unsupported encoding %s (use 65001, 1252, or 28591)", codePage)
+	}
+}
+
+func trimUtf8Bom(data []byte) []byte {
+	if len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
+		return data[3:]
+	}
+	return data
+}
+
+// cp1252 holds the characters Windows-1252 places at 0x80-0x9F; the rest of
+// the code page matches Latin-1.
+var cp1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
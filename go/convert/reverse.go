@@ -0,0 +1,113 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConvertCsvFiles converts CSVs written by this tool back into source files in
+// opts.OutputFormat, usfm (the default) or usx. A CSV that holds several books, such
+// as a merged one, is written as one file per book named <input>_<BOOK>, and
+// gets a result per book. Existing files, such as the source the CSV was made
+// from, are only replaced when opts.Overwrite is set.
+func ConvertCsvFiles(paths []string, outputFolder string, opts Options) (Summary, error) {
+	if opts.OutputFormat == "" {
+		opts.OutputFormat = OutputUSFM
+	}
+	if err := validateSourceFormat(opts.OutputFormat); err != nil {
+		return Summary{}, err
+	}
+	if outputFolder != "" {
+		if err := os.MkdirAll(outputFolder, 0o755); err != nil {
+			return Summary{}, err
+		}
+	}
+
+	fileResults := make([][]FileResult, len(paths))
+	err := runJobs(len(paths), jobCount(opts, len(paths)), func(i int) error {
+		results, err := convertCsvFile(paths[i], outputFolder, opts)
+		if err != nil {
+			if !opts.KeepGoing {
+				return err
+			}
+			results = []FileResult{failedResult(paths[i], err, opts)}
+		}
+		fileResults[i] = results
+		return nil
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	var results []FileResult
+	for _, r := range fileResults {
+		results = append(results, r...)
+	}
+	return Summary{Files: results, Failed: countFailed(results)}, nil
+}
+
+func convertCsvFile(path, outputFolder string, opts Options) ([]FileResult, error) {
+	progressf(opts, "Processing (CSV) %s", path)
+	doc, err := ParseCsvFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Books) == 0 {
+		return nil, fmt.Errorf("No verse rows found in %s", path)
+	}
+
+	base := outputPath(path, outputFolder, opts)
+	outputs := make([]string, len(doc.Books))
+	for i, book := range doc.Books {
+		out := base
+		if len(doc.Books) > 1 {
+			ext := filepath.Ext(base)
+			out = strings.TrimSuffix(base, ext) + "_" + book.Code + ext
+		}
+		if samePath(out, path) {
+			return nil, fmt.Errorf("Output would overwrite input: %s", path)
+		}
+		if _, err := os.Stat(out); err == nil && !opts.Overwrite {
+			return nil, fmt.Errorf("Output already exists: %s", out)
+		}
+		outputs[i] = out
+	}
+
+	var results []FileResult
+	for i, book := range doc.Books {
+		out := outputs[i]
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			return nil, err
+		}
+		verses, err := writeSource(out, &Document{Format: doc.Format, Books: []*Book{book}}, opts.OutputFormat)
+		if err != nil {
+			return nil, err
+		}
+		progressf(opts, "Created %s: %s", strings.ToUpper(opts.OutputFormat), out)
+
+		result := FileResult{Input: path, Output: out, Format: doc.Format, Rows: verses, Status: StatusOK}
+		if i == 0 {
+			result.Warnings = doc.Issues
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func validateSourceFormat(format string) error {
+	switch format {
+	case OutputUSFM, OutputUSX:
+		return nil
+	default:
+		return fmt.Errorf("Unknown output format: %s (use usfm or usx)", format)
+	}
+}
+
+func writeSource(path string, doc *Document, format string) (int, error) {
+	if format == OutputUSX {
+		return writeUsx(path, doc)
+	}
+	return writeUsfm(path, doc)
+}
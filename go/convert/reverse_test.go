@@ -0,0 +1,42 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const sampleCsv = `Book,Chapter,Verse,TextPlain,TextStyled,Footnotes,Crossrefs,Subtitle,VerseStart,VerseEnd,Segment
+MAT,1,1,the SMALL caps,the <span>SMALL</span> caps,a note,Mk 1:1,Heading,1,1,
+MAT,1,2,Jesus said go,<wj>Jesus said <i>go</i></wj>,first | second,,Heading,2,2,
+`
+
+func TestCsvRoundTrip(t *testing.T) {
+	for _, format := range []string{OutputUSFM, OutputUSX} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			csvPath := filepath.Join(dir, "MAT.csv")
+			if err := os.WriteFile(csvPath, []byte(sampleCsv), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			sourceDir := filepath.Join(dir, "source")
+			if _, err := ConvertCsvFiles([]string{csvPath}, sourceDir, Options{OutputFormat: format, Quiet: true}); err != nil {
+				t.Fatalf("ConvertCsvFiles: %v", err)
+			}
+			backDir := filepath.Join(dir, "back")
+			source := filepath.Join(sourceDir, "MAT."+format)
+			if _, err := ConvertFiles([]string{source}, backDir, Options{Quiet: true}); err != nil {
+				t.Fatalf("ConvertFiles: %v", err)
+			}
+
+			back, err := os.ReadFile(filepath.Join(backDir, "MAT.csv"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(back) != sampleCsv {
+				t.Errorf("CSV changed after %s round trip:\n%s\nwant:\n%s", format, back, sampleCsv)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckRoundTrip converts each source file to CSV, converts the CSV back to
+// the file's own format (USFM/SFM or USX), parses that again and reports
+// every verse whose text, styles, notes or heading came back different.
+// Nothing is written next to the inputs; the intermediate files live in a
+// temporary folder.
+func CheckRoundTrip(paths []string, opts Options) (ValidationReport, error) {
+	if err := validateNoteMode(opts.NoteMode); err != nil {
+		return ValidationReport{}, err
+	}
+	report := ValidationReport{}
+	for _, path := range paths {
+		issues, err := checkRoundTrip(path, opts)
+		if err != nil {
+			return ValidationReport{}, err
+		}
+		report.Files = append(report.Files, FileValidation{Input: inputName(path, opts), Issues: issues})
+		report.Issues += len(issues)
+	}
+	return report, nil
+}
+
+func checkRoundTrip(path string, opts Options) ([]Issue, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	format := OutputUSFM
+	switch ext {
+	case ".usx":
+		format = OutputUSX
+	case ".usfm", ".sfm":
+	default:
+		return nil, fmt.Errorf("Round-trip check supports only USX and USFM/SFM files: %s", path)
+	}
+
+	source, err := parseInput(path, opts.Projects)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.PreserveOrder {
+		sortDocument(source)
+	}
+
+	tempDir, err := os.MkdirTemp("", "usxtocsv-roundtrip-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	csvPath := filepath.Join(tempDir, stem+".csv")
+	if _, err := writeCsv(csvPath, source, opts.NoteMode); err != nil {
+		return nil, err
+	}
+	fromCsv, err := ParseCsvFile(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	backPath := filepath.Join(tempDir, stem+ext)
+	if _, err := writeSource(backPath, fromCsv, format); err != nil {
+		return nil, err
+	}
+	back, err := ParseFile(backPath)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.PreserveOrder {
+		sortDocument(back)
+	}
+	return compareRoundTrip(source, back), nil
+}
+
+type roundTripVerse struct {
+	ref    string
+	pos    Position
+	fields [][2]string
+}
+
+// roundTripVerses lists the output rows of doc with the fields the check
+// compares. Styles and notes are given in full, so differences the CSV
+// columns cannot show, such as a lost \fr part, are reported too.
+func roundTripVerses(doc *Document) []roundTripVerse {
+	var verses []roundTripVerse
+	doc.eachRow(func(book *Book, chapter *Chapter, verse *Verse) error {
+		verses = append(verses, roundTripVerse{
+			ref: fmt.Sprintf("%s %s:%s", book.Code, chapter.Number, verse.Number),
+			pos: verse.Pos,
+			fields: [][2]string{
+				{"text", verse.PlainText()},
+				{"styles", normalizeWhitespace(verse.markupText(
+					func(style string, depth int) string { return "<" + style + ">" },
+					func(style string, depth int) string { return "</" + style + ">" },
+				))},
+				{"footnotes", noteDetails(verse, false)},
+				{"crossrefs", noteDetails(verse, true)},
+				{"subtitle", verse.Subtitle},
+			},
+		})
+		return nil
+	})
+	return verses
+}
+
+func noteDetails(verse *Verse, crossrefs bool) string {
+	var notes []string
+	for _, note := range verse.Notes {
+		if note.IsCrossref() != crossrefs {
+			continue
+		}
+		var parts []string
+		for _, part := range note.Parts {
+			if text := normalizeWhitespace(part.Text); text != "" {
+				parts = append(parts, `\`+part.Style+" "+text)
+			}
+		}
+		notes = append(notes, strings.Join(parts, " "))
+	}
+	return strings.Join(notes, " | ")
+}
+
+// compareRoundTrip matches verses by reference, in order when a reference
+// repeats, and reports each field that differs.
+func compareRoundTrip(source, back *Document) []Issue {
+	before, after := roundTripVerses(source), roundTripVerses(back)
+	pending := map[string][]int{}
+	for i, w := range after {
+		pending[w.ref] = append(pending[w.ref], i)
+	}
+	matched := make([]bool, len(after))
+
+	issues := []Issue{}
+	for _, v := range before {
+		queue := pending[v.ref]
+		if len(queue) == 0 {
+			issues = append(issues, Issue{Position: v.pos, Code: "lost-verse", Message: fmt.Sprintf("Verse %s is missing after the round trip", v.ref)})
+			continue
+		}
+		w := after[queue[0]]
+		matched[queue[0]] = true
+		pending[v.ref] = queue[1:]
+		for i, field := range v.fields {
+			if field[1] != w.fields[i][1] {
+				issues = append(issues, Issue{
+					Position: v.pos,
+					Code:     "changed-" + field[0],
+					Message:  fmt.Sprintf("Verse %s %s changed: \"%s\" became \"%s\"", v.ref, field[0], field[1], w.fields[i][1]),
+				})
+			}
+		}
+	}
+	for i, w := range after {
+		if !matched[i] {
+			issues = append(issues, Issue{Code: "added-verse", Message: fmt.Sprintf("Verse %s appears only after the round trip", w.ref)})
+		}
+	}
+	return issues
+}
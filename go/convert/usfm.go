@@ -0,0 +1,541 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var reUsfmVerseNumber = regexp.MustCompile(`^\d+[a-zA-Z]*(?:\s*[-\x{2010}-\x{2013}]\s*\d+[a-zA-Z]*)?`)
+
+type usfmToken struct {
+	Marker  string
+	Nested  bool
+	Closing bool
+	Text    string
+	Line    int
+	Column  int
+}
+
+func (t usfmToken) isText() bool {
+	return t.Marker == "" && !t.Closing
+}
+
+type usfmMarkerKind int
+
+const (
+	usfmUnknown usfmMarkerKind = iota
+	usfmBook
+	usfmChapter
+	usfmVerse
+	usfmBodyPara
+	usfmHeadingPara
+	usfmIgnoredPara
+	usfmChar
+	usfmSkipChar
+	usfmNote
+	usfmNotePart
+	usfmBreak
+)
+
+var usfmMarkerKinds = map[string]usfmMarkerKind{
+	"id": usfmBook,
+	"c":  usfmChapter,
+	"v":  usfmVerse,
+}
+
+func init() {
+	for _, name := range []string{"p", "m", "po", "pr", "cls", "pmo", "pm", "pmc", "pmr", "pi", "mi", "nb", "pc", "ph", "q", "qr", "qc", "qa", "qm", "qd", "lh", "li", "lf", "lim", "b", "tr"} {
+		usfmMarkerKinds[name] = usfmBodyPara
+	}
+	for _, name := range []string{"mt", "mte", "ms", "mr", "s", "sr", "r", "d", "sp", "sd", "cl", "cd"} {
+		usfmMarkerKinds[name] = usfmHeadingPara
+	}
+	for _, name := range []string{"ide", "sts", "rem", "h", "toc", "toca", "usfm", "cp", "imt", "imte", "is", "ip", "ipi", "im", "imi", "ipq", "imq", "ipr", "iq", "ib", "ili", "iot", "io", "iex", "ie", "lit"} {
+		usfmMarkerKinds[name] = usfmIgnoredPara
+	}
+	for _, name := range []string{"add", "bk", "dc", "k", "nd", "ord", "pn", "png", "addpn", "qt", "sig", "sls", "tl", "wj", "em", "bd", "it", "bdit", "no", "sc", "w", "rb", "pro", "wg", "wh", "wa", "jmp", "ior", "iqt", "rq", "qs", "qac", "lik", "liv", "litl", "ndx"} {
+		usfmMarkerKinds[name] = usfmChar
+	}
+	for _, name := range []string{"sup", "va", "vp", "ca", "fig", "cat"} {
+		usfmMarkerKinds[name] = usfmSkipChar
+	}
+	for _, name := range []string{"th", "thr", "thc", "tc", "tcr", "tcc", "pb", "esb", "esbe"} {
+		usfmMarkerKinds[name] = usfmBreak
+	}
+	for _, name := range []string{"f", "fe", "ef", "x", "ex"} {
+		usfmMarkerKinds[name] = usfmNote
+	}
+	for _, name := range []string{"fr", "fq", "fqa", "fk", "ft", "fl", "fw", "fp", "fv", "fdc", "fm", "xo", "xk", "xq", "xt", "xta", "xop", "xot", "xnt", "xdc"} {
+		usfmMarkerKinds[name] = usfmNotePart
+	}
+}
+
+func usfmMarkerKindOf(marker string) usfmMarkerKind {
+	if kind, ok := usfmMarkerKinds[marker]; ok {
+		return kind
+	}
+	if kind, ok := usfmMarkerKinds[strings.TrimRight(marker, "0123456789")]; ok {
+		return kind
+	}
+	return usfmUnknown
+}
+
+func isUsfmMilestone(marker string) bool {
+	return strings.HasSuffix(marker, "-s") || strings.HasSuffix(marker, "-e")
+}
+
+// endsUsfmMilestone reports whether a marker of this kind ends a milestone
+// whose \* is missing, so its attributes cannot swallow the rest of the book.
+func endsUsfmMilestone(kind usfmMarkerKind) bool {
+	switch kind {
+	case usfmBook, usfmChapter, usfmVerse, usfmBodyPara, usfmHeadingPara, usfmIgnoredPara:
+		return true
+	default:
+		return false
+	}
+}
+
+func lexUsfm(content string) []usfmToken {
+	var tokens []usfmToken
+	line, lineStart := 1, 0
+
+	advance := func(from, to int) {
+		for k := from; k < to; k++ {
+			if content[k] == '\n' {
+				line++
+				lineStart = k + 1
+			}
+		}
+	}
+
+	i := 0
+	for i < len(content) {
+		tok := usfmToken{Line: line, Column: utf8.RuneCountInString(content[lineStart:i]) + 1}
+		start := i
+
+		if content[i] == '\\' {
+			j := i + 1
+			if j < len(content) && content[j] == '+' {
+				tok.Nested = true
+				j++
+			}
+			nameStart := j
+			for j < len(content) && isUsfmMarkerByte(content[j]) {
+				j++
+			}
+			tok.Marker = strings.ToLower(content[nameStart:j])
+			if j < len(content) && content[j] == '*' {
+				tok.Closing = true
+				j++
+			}
+			if tok.Marker != "" || tok.Closing {
+				if !tok.Closing {
+					if j < len(content) && content[j] == '\r' {
+						j++
+					}
+					if j < len(content) && (content[j] == ' ' || content[j] == '\t' || content[j] == '\n') {
+						j++
+					}
+				}
+				tokens = append(tokens, tok)
+				advance(start, j)
+				i = j
+				continue
+			}
+			i++
+		}
+
+		for i < len(content) && content[i] != '\\' {
+			i++
+		}
+		tok.Text = content[start:i]
+		tokens = append(tokens, tok)
+		advance(start, i)
+	}
+
+	return tokens
+}
+
+func isUsfmMarkerByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'
+}
+
+type usfmCharStyle struct {
+	name  string
+	skip  bool
+	attrs bool
+}
+
+type usfmParser struct {
+	b            *docBuilder
+	bookSeen     bool
+	pending      usfmMarkerKind
+	pendingPos   Position
+	paraKind     usfmMarkerKind
+	paraStyle    string
+	heading      strings.Builder
+	styles       []usfmCharStyle
+	milestone    string
+	milestonePos Position
+
+	note       *Note
+	notePos    Position
+	noteCaller bool
+	noteStyles []usfmCharStyle
+	notePart   NotePart
+	noteAttrs  bool
+}
+
+func parseUsfmFile(usfmPath string) (*Document, error) {
+	data, err := os.ReadFile(usfmPath)
+	if err != nil {
+		return nil, err
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(usfmPath)), ".")
+	fallbackBook := bookCodeFromFileName(filepath.Base(usfmPath))
+	return parseUsfm(string(data), format, fallbackBook), nil
+}
+
+func parseUsfm(content, format, fallbackBook string) *Document {
+	p := &usfmParser{b: newDocBuilder(format)}
+	tokens := lexUsfm(content)
+
+	if !hasUsfmBookID(tokens) {
+		p.b.startBook(fallbackBook, Position{})
+		p.bookSeen = true
+	}
+	for _, tok := range tokens {
+		if tok.isText() {
+			p.text(tok.Text)
+		} else {
+			p.marker(tok)
+		}
+	}
+	if p.milestone != "" {
+		p.unclosedMilestone()
+	}
+	p.closeParagraph()
+	return p.b.finish()
+}
+
+func hasUsfmBookID(tokens []usfmToken) bool {
+	for i, tok := range tokens {
+		if tok.Marker == "id" && !tok.Closing && i+1 < len(tokens) && tokens[i+1].isText() {
+			return len(strings.Fields(tokens[i+1].Text)) > 0
+		}
+	}
+	return false
+}
+
+func (p *usfmParser) marker(tok usfmToken) {
+	p.pending = usfmUnknown
+	pos := Position{Line: tok.Line, Column: tok.Column}
+
+	if tok.Closing {
+		p.closeMarker(tok.Marker, pos)
+		return
+	}
+	kind := usfmMarkerKindOf(tok.Marker)
+	if p.milestone != "" {
+		if !endsUsfmMilestone(kind) {
+			return
+		}
+		p.unclosedMilestone()
+	}
+	if tok.Marker == "ts" {
+		return
+	}
+	if isUsfmMilestone(tok.Marker) {
+		p.milestone = tok.Marker
+		p.milestonePos = pos
+		return
+	}
+
+	if p.note != nil {
+		switch kind {
+		case usfmNotePart:
+			if !tok.Nested {
+				p.flushNotePart()
+				p.notePart = NotePart{Style: tok.Marker}
+				return
+			}
+			p.noteStyles = append(p.noteStyles, usfmCharStyle{name: tok.Marker})
+			return
+		case usfmChar, usfmSkipChar:
+			p.noteStyles = append(p.noteStyles, usfmCharStyle{name: tok.Marker, skip: kind == usfmSkipChar})
+			return
+		case usfmBreak:
+			p.notePart.Text += " "
+			return
+		case usfmUnknown:
+			p.unknownMarker(tok.Marker, pos)
+			p.notePart.Text += " "
+			return
+		}
+		p.unclosedNote()
+	}
+
+	switch kind {
+	case usfmBook:
+		p.closeParagraph()
+		p.paraKind = usfmIgnoredPara
+		p.pending = usfmBook
+		p.pendingPos = pos
+	case usfmChapter:
+		p.closeParagraph()
+		p.pending = usfmChapter
+		p.pendingPos = pos
+	case usfmVerse:
+		if p.paraKind == usfmHeadingPara || p.paraKind == usfmIgnoredPara {
+			p.closeParagraph()
+		}
+		p.styles = nil
+		p.pending = usfmVerse
+		p.pendingPos = pos
+	case usfmBodyPara:
+		p.closeParagraph()
+		p.paraKind = kind
+		p.paraStyle = tok.Marker
+		p.b.startParagraph(tok.Marker)
+	case usfmHeadingPara, usfmIgnoredPara:
+		p.closeParagraph()
+		p.paraKind = kind
+		p.paraStyle = tok.Marker
+	case usfmChar, usfmSkipChar:
+		if !tok.Nested {
+			p.styles = nil
+		}
+		p.styles = append(p.styles, usfmCharStyle{name: tok.Marker, skip: kind == usfmSkipChar})
+	case usfmNote:
+		p.note = &Note{Style: tok.Marker}
+		p.notePos = pos
+		p.noteCaller = true
+		p.noteStyles = nil
+		p.notePart = NotePart{}
+		p.noteAttrs = false
+	case usfmBreak:
+		p.emit(" ")
+	default:
+		p.unknownMarker(tok.Marker, pos)
+		p.emit(" ")
+	}
+}
+
+func (p *usfmParser) unclosedMilestone() {
+	p.b.warn(p.milestonePos, "unclosed-milestone", fmt.Sprintf(`Milestone \%s is not closed with \*`, p.milestone))
+	p.milestone = ""
+}
+
+func (p *usfmParser) unknownMarker(marker string, pos Position) {
+	p.b.warn(pos, "unknown-marker", fmt.Sprintf(`Unknown marker \%s stripped`, marker))
+}
+
+func (p *usfmParser) closeMarker(marker string, pos Position) {
+	if marker == "" {
+		p.milestone = ""
+		return
+	}
+	if p.milestone != "" {
+		return
+	}
+
+	if p.note != nil {
+		if marker == p.note.Style {
+			p.finishNote()
+			return
+		}
+		if i := findUsfmStyle(p.noteStyles, marker); i >= 0 {
+			p.noteStyles = p.noteStyles[:i]
+			return
+		}
+		if marker == p.notePart.Style {
+			p.flushNotePart()
+			p.notePart = NotePart{}
+		}
+		return
+	}
+
+	if i := findUsfmStyle(p.styles, marker); i >= 0 {
+		p.styles = p.styles[:i]
+		return
+	}
+	if usfmMarkerKindOf(marker) == usfmUnknown {
+		p.unknownMarker(marker+"*", pos)
+	}
+}
+
+func findUsfmStyle(styles []usfmCharStyle, marker string) int {
+	for i := len(styles) - 1; i >= 0; i-- {
+		if styles[i].name == marker {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *usfmParser) text(text string) {
+	if p.milestone != "" {
+		return
+	}
+
+	switch p.pending {
+	case usfmBook, usfmChapter, usfmVerse:
+		arg, rest := splitUsfmArgument(text)
+		if p.pending == usfmVerse {
+			arg, rest = splitUsfmVerseNumber(text)
+		}
+		kind := p.pending
+		p.pending = usfmUnknown
+		if arg == "" {
+			return
+		}
+		switch kind {
+		case usfmBook:
+			if !p.bookSeen {
+				p.b.startBook(arg, p.pendingPos)
+				p.bookSeen = true
+			}
+			return
+		case usfmChapter:
+			p.b.startChapter(arg, p.pendingPos)
+		case usfmVerse:
+			p.b.startVerse(arg, p.pendingPos)
+		}
+		text = rest
+	}
+
+	if p.note != nil {
+		p.noteText(text)
+		return
+	}
+	p.emit(text)
+}
+
+func (p *usfmParser) emit(text string) {
+	n := len(p.styles)
+	if n > 0 {
+		if p.styles[n-1].attrs {
+			return
+		}
+		if i := strings.IndexByte(text, '|'); i >= 0 {
+			text = text[:i]
+			p.styles[n-1].attrs = true
+		}
+	}
+	for _, style := range p.styles {
+		if style.skip {
+			return
+		}
+	}
+
+	switch p.paraKind {
+	case usfmHeadingPara:
+		p.heading.WriteString(text)
+	case usfmIgnoredPara:
+	default:
+		p.b.addText(text, p.styleNames())
+	}
+}
+
+func (p *usfmParser) styleNames() []string {
+	if len(p.styles) == 0 {
+		return nil
+	}
+	names := make([]string, len(p.styles))
+	for i, style := range p.styles {
+		names[i] = style.name
+	}
+	return names
+}
+
+func (p *usfmParser) noteText(text string) {
+	if p.noteCaller {
+		p.noteCaller = false
+		if caller, rest := splitUsfmArgument(text); caller != "" {
+			p.note.Caller = caller
+			text = rest
+		}
+	}
+	for _, style := range p.noteStyles {
+		if style.skip {
+			return
+		}
+	}
+	if p.noteAttrs {
+		return
+	}
+	if i := strings.IndexByte(text, '|'); i >= 0 {
+		text = text[:i]
+		p.noteAttrs = true
+	}
+	p.notePart.Text += text
+}
+
+func (p *usfmParser) flushNotePart() {
+	p.noteAttrs = false
+	if strings.TrimSpace(p.notePart.Text) == "" {
+		return
+	}
+	p.note.Parts = append(p.note.Parts, p.notePart)
+}
+
+func (p *usfmParser) finishNote() {
+	p.flushNotePart()
+	if p.paraKind != usfmHeadingPara && p.paraKind != usfmIgnoredPara {
+		p.b.addNote(p.note)
+	}
+	p.note = nil
+	p.noteStyles = nil
+	p.notePart = NotePart{}
+}
+
+func (p *usfmParser) unclosedNote() {
+	p.b.warn(p.notePos, "unclosed-note", fmt.Sprintf(`Note \%s is not closed with \%s*`, p.note.Style, p.note.Style))
+	p.finishNote()
+}
+
+func (p *usfmParser) closeParagraph() {
+	if p.note != nil {
+		p.unclosedNote()
+	}
+	p.styles = nil
+
+	switch p.paraKind {
+	case usfmHeadingPara:
+		if isSubtitleStyle(p.paraStyle) {
+			p.b.addHeading(p.paraStyle, normalizeWhitespace(p.heading.String()))
+		}
+		p.heading.Reset()
+	case usfmBodyPara:
+		p.b.endParagraph()
+	}
+	p.paraKind = usfmUnknown
+	p.paraStyle = ""
+}
+
+func splitUsfmArgument(text string) (string, string) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	end := strings.IndexFunc(text, unicode.IsSpace)
+	if end < 0 {
+		return text, ""
+	}
+	return text[:end], text[end:]
+}
+
+// splitUsfmVerseNumber reads a \v number, including bridges written with
+// spaces or Unicode dashes ("1 - 2", "3a–4b"), and returns it without the
+// inner whitespace.
+func splitUsfmVerseNumber(text string) (string, string) {
+	trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+	m := reUsfmVerseNumber.FindString(trimmed)
+	if m == "" {
+		return splitUsfmArgument(text)
+	}
+	return strings.Join(strings.Fields(m), ""), trimmed[len(m):]
+}
@@ -0,0 +1,153 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type usfmRow struct {
+	plain     string
+	styled    string
+	footnotes []string
+}
+
+func TestParseUsfm(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		rows   map[string]usfmRow
+		issues []string
+	}{
+		{
+			name:  "nested character styles",
+			input: `\id MAT` + "\n" + `\c 1` + "\n" + `\p` + "\n" + `\v 1 The \wj Lord \+nd God\+nd* said\wj* so.`,
+			rows: map[string]usfmRow{
+				"1": {plain: "The Lord God said so.", styled: "The <wj>Lord <nd>God</nd> said</wj> so."},
+			},
+		},
+		{
+			name:  "unnested marker closes open styles",
+			input: `\id MAT` + "\n" + `\c 1` + "\n" + `\p` + "\n" + `\v 1 \bd bold \it italic\it* plain`,
+			rows: map[string]usfmRow{
+				"1": {plain: "bold italic plain", styled: "<b>bold</b> <i>italic</i> plain"},
+			},
+		},
+		{
+			name:  "attributes are dropped",
+			input: `\id MAT` + "\n" + `\c 1` + "\n" + `\p` + "\n" + `\v 1 In the \w beginning|lemma="arche" strong="G746"\w* was`,
+			rows: map[string]usfmRow{
+				"1": {plain: "In the beginning was", styled: "In the <span>beginning</span> was"},
+			},
+		},
+		{
+			name:  "closed milestone",
+			input: `\id MAT` + "\n" + `\c 1` + "\n" + `\p` + "\n" + `\v 1 one \qt-s |who="Jesus"\*said\qt-e\*` + "\n" + `\v 2 two`,
+			rows: map[string]usfmRow{
+				"1": {plain: "one said", styled: "one said"},
+				"2": {plain: "two", styled: "two"},
+			},
+		},
+		{
+			name:  "bare ts marker",
+			input: `\id MAT` + "\n" + `\c 1` + "\n" + `\p` + "\n" + `\v 1 one` + "\n" + `\ts` + "\n" + `\v 2 two` + "\n" + `\v 3 three`,
+			rows: map[string]usfmRow{
+				"1": {plain: "one", styled: "one"},
+				"2": {plain: "two", styled: "two"},
+				"3": {plain: "three", styled: "three"},
+			},
+		},
+		{
+			name:  "unclosed milestone ends at the next verse",
+			input: `\id MAT` + "\n" + `\c 1` + "\n" + `\p` + "\n" + `\v 1 one \qt-s |who="x"` + "\n" + `\v 2 two` + "\n" + `\v 3 three`,
+			rows: map[string]usfmRow{
+				"1": {plain: "one", styled: "one"},
+				"2": {plain: "two", styled: "two"},
+				"3": {plain: "three", styled: "three"},
+			},
+			issues: []string{"unclosed-milestone"},
+		},
+		{
+			name:  "footnote first ft",
+			input: `\id MAT` + "\n" + `\c 1` + "\n" + `\p` + "\n" + `\v 1 text\f + \fr 1.1 \ft first \fq quote\fq* \ft second\f* more`,
+			rows: map[string]usfmRow{
+				"1": {plain: "text more", styled: "text more", footnotes: []string{"first"}},
+			},
+		},
+		{
+			name:  "unclosed note ends at the next paragraph",
+			input: `\id MAT` + "\n" + `\c 1` + "\n" + `\p` + "\n" + `\v 1 text\f + \ft note` + "\n" + `\p` + "\n" + `\v 2 two`,
+			rows: map[string]usfmRow{
+				"1": {plain: "text", styled: "text", footnotes: []string{"note"}},
+				"2": {plain: "two", styled: "two"},
+			},
+			issues: []string{"unclosed-note"},
+		},
+		{
+			name:  "unknown marker",
+			input: `\id MAT` + "\n" + `\c 1` + "\n" + `\p` + "\n" + `\v 1 one \zz two`,
+			rows: map[string]usfmRow{
+				"1": {plain: "one two", styled: "one two"},
+			},
+			issues: []string{"unknown-marker"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseUsfm(tt.input, "usfm", "")
+			rows := map[string]usfmRow{}
+			doc.eachRow(func(book *Book, chapter *Chapter, verse *Verse) error {
+				rows[verse.Number] = usfmRow{plain: verse.PlainText(), styled: verse.StyledText(), footnotes: verse.Footnotes()}
+				return nil
+			})
+			if !reflect.DeepEqual(rows, tt.rows) {
+				t.Errorf("rows = %+v, want %+v", rows, tt.rows)
+			}
+
+			var codes []string
+			for _, issue := range doc.Issues {
+				codes = append(codes, issue.Code)
+			}
+			if !reflect.DeepEqual(codes, tt.issues) {
+				t.Errorf("issues = %v, want %v", codes, tt.issues)
+			}
+		})
+	}
+}
+
+func TestParseUsfmUnclosedMilestonePosition(t *testing.T) {
+	input := strings.Join([]string{`\id MAT`, `\c 1`, `\p`, `\v 1 one \qt-s |who="x"`, `\v 2 two`}, "\n")
+	doc := parseUsfm(input, "usfm", "")
+	if len(doc.Issues) != 1 {
+		t.Fatalf("issues = %v, want one", doc.Issues)
+	}
+	if got := doc.Issues[0].Position; got != (Position{Line: 4, Column: 10}) {
+		t.Errorf("position = %+v, want line 4 column 10", got)
+	}
+}
+
+func TestUsfmNoteMarkup(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "ft only", input: `\f + \ft note\f*`, want: `\f + \ft note\f*`},
+		{name: "text after closed fq", input: `\f + \ft Or \fq set\fq* about\f*`, want: `\f + \ft Or \fq set\fq* about\f*`},
+		{name: "cross reference", input: `\x - \xo 1.1 \xt Mk 1:1\x*`, want: `\x - \xo 1.1 \xt Mk 1:1\x*`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseUsfm(`\id MAT`+"\n"+`\c 1`+"\n"+`\p`+"\n"+`\v 1 text`+tt.input, "usfm", "")
+			verse := doc.Books[0].Chapters[0].Verses[0]
+			if len(verse.Notes) != 1 {
+				t.Fatalf("notes = %d, want 1", len(verse.Notes))
+			}
+			if got := usfmNoteMarkup(verse.Notes[0]); got != tt.want {
+				t.Errorf("usfmNoteMarkup = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package convert
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// writeUsfm writes doc as USFM: an \id line per book, headings and body
+// paragraphs in document order, and one \v line per verse with its notes at
+// the end. It returns the number of verses written.
+func writeUsfm(path string, doc *Document) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	verses := 0
+	for _, book := range doc.Books {
+		w.WriteString(`\id ` + book.Code + "\n")
+		for _, para := range book.Paragraphs {
+			if para.Heading != "" {
+				writeUsfmHeading(w, para)
+			}
+		}
+		for _, chapter := range book.Chapters {
+			w.WriteString(`\c ` + chapter.Number + "\n")
+			for _, para := range chapter.layout() {
+				if para.Heading != "" || isSubtitleStyle(para.Style) {
+					writeUsfmHeading(w, para)
+					continue
+				}
+				w.WriteString(`\` + para.Style + "\n")
+				for _, verse := range para.Verses {
+					writeUsfmVerse(w, verse)
+				}
+				verses += len(para.Verses)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return verses, nil
+}
+
+func writeUsfmHeading(w *bufio.Writer, para *Paragraph) {
+	if para.Heading == "" {
+		return
+	}
+	w.WriteString(`\` + para.Style + " " + para.Heading + "\n")
+}
+
+func writeUsfmVerse(w *bufio.Writer, verse *Verse) {
+	line := `\v ` + verse.Number
+	text := normalizeWhitespace(verse.markupText(
+		func(style string, depth int) string { return usfmCharMarker(style, depth) + " " },
+		func(style string, depth int) string { return usfmCharMarker(style, depth) + "*" },
+	))
+	if text != "" {
+		line += " " + text
+	}
+	for _, note := range verse.Notes {
+		line += usfmNoteMarkup(note)
+	}
+	w.WriteString(line + "\n")
+}
+
+// usfmCharMarker prefixes nested character styles with + as USFM 3 requires.
+func usfmCharMarker(style string, depth int) string {
+	if depth > 0 {
+		return `\+` + style
+	}
+	return `\` + style
+}
+
+// usfmNoteMarkup writes a note with one marker per part. A part without a
+// style, such as text after \fq*, is written as plain text after closing the
+// part before it.
+func usfmNoteMarkup(note *Note) string {
+	caller := note.Caller
+	if caller == "" {
+		caller = "+"
+	}
+	var b strings.Builder
+	b.WriteString(`\` + note.Style + " " + caller)
+	previous := ""
+	for _, part := range note.Parts {
+		text := normalizeWhitespace(part.Text)
+		if text == "" {
+			continue
+		}
+		if part.Style == "" {
+			if previous != "" {
+				b.WriteString(`\` + previous + "*")
+			}
+			if strings.TrimLeftFunc(part.Text, unicode.IsSpace) != part.Text {
+				b.WriteString(" ")
+			}
+			b.WriteString(text)
+		} else {
+			b.WriteString(` \` + part.Style + " " + text)
+		}
+		previous = part.Style
+	}
+	b.WriteString(`\` + note.Style + "*")
+	return b.String()
+}
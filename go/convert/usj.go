@@ -0,0 +1,75 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+func parseUsjFile(usjPath string) (*Document, error) {
+	data, err := os.ReadFile(usjPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Invalid USJ in %s: %v", usjPath, err)
+	}
+
+	root := usjToNode(raw)
+	if root == nil || root.Name != "usx" {
+		return nil, fmt.Errorf("No USJ root found in %s", usjPath)
+	}
+	return buildUsxDocument(root, usjPath, "usj")
+}
+
+// LooksLikeUsj tells USJ documents apart from other .json files, such as
+// earlier -format json output, when scanning folders.
+func LooksLikeUsj(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	return bytes.Contains(head[:n], []byte(`"USJ"`))
+}
+
+func usjToNode(obj map[string]any) *node {
+	name, _ := obj["type"].(string)
+	if name == "USJ" {
+		name = "usx"
+	}
+
+	n := &node{
+		Type:  nodeElement,
+		Name:  name,
+		Attrs: map[string]string{},
+	}
+	for key, value := range obj {
+		s, ok := value.(string)
+		if !ok || key == "type" {
+			continue
+		}
+		if key == "marker" {
+			key = "style"
+		}
+		n.Attrs[key] = s
+	}
+
+	content, _ := obj["content"].([]any)
+	for _, item := range content {
+		switch v := item.(type) {
+		case string:
+			n.Children = append(n.Children, &node{Type: nodeText, Text: v})
+		case map[string]any:
+			n.Children = append(n.Children, usjToNode(v))
+		}
+	}
+	return n
+}
@@ -0,0 +1,267 @@
+package convert
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type nodeType int
+
+const (
+	nodeElement nodeType = iota
+	nodeText
+)
+
+type node struct {
+	Type     nodeType
+	Name     string
+	Attrs    map[string]string
+	Children []*node
+	Text     string
+	Pos      Position
+}
+
+// usxState carries the builder through the tree walk. legacyVerses is set for
+// USX 1.x/2.x, where <verse> has no sid/eid and a verse runs until the next
+// verse, chapter or book end.
+type usxState struct {
+	b            *docBuilder
+	legacyVerses bool
+}
+
+func parseUsxFile(usxPath string) (*Document, error) {
+	root, err := parseXML(usxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if root == nil || root.Name != "usx" {
+		return nil, fmt.Errorf("No <usx> root found in %s", usxPath)
+	}
+	return buildUsxDocument(root, usxPath, "usx")
+}
+
+func buildUsxDocument(root *node, path, format string) (*Document, error) {
+	bookNode := findFirstChild(root, "book")
+	if bookNode == nil {
+		return nil, fmt.Errorf("No <book> found in %s", path)
+	}
+
+	state := &usxState{
+		b:            newDocBuilder(format),
+		legacyVerses: isLegacyUsx(root),
+	}
+	state.b.startBook(getAttrValue(bookNode, "code"), bookNode.Pos)
+	for _, child := range root.Children {
+		processUsxNode(child, state, nil)
+	}
+	return state.b.finish(), nil
+}
+
+func isLegacyUsx(root *node) bool {
+	if version := getAttrValue(root, "version"); version != "" {
+		major, _, _ := strings.Cut(version, ".")
+		return parseInt(major) < 3
+	}
+	return !hasVerseMilestones(root)
+}
+
+func hasVerseMilestones(n *node) bool {
+	if n.Type == nodeElement && n.Name == "verse" && (getAttrValue(n, "sid") != "" || getAttrValue(n, "eid") != "") {
+		return true
+	}
+	for _, child := range n.Children {
+		if hasVerseMilestones(child) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseXML(path string) (*node, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := xml.NewDecoder(file)
+	var stack []*node
+	var root *node
+
+	for {
+		line, column := decoder.InputPos()
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{
+				Type:  nodeElement,
+				Name:  t.Name.Local,
+				Attrs: map[string]string{},
+				Pos:   Position{Line: line, Column: column},
+			}
+			for _, attr := range t.Attr {
+				n.Attrs[attr.Name.Local] = attr.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			} else {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) == 0 {
+				continue
+			}
+			text := string(t)
+			if text == "" {
+				continue
+			}
+			n := &node{
+				Type: nodeText,
+				Text: text,
+			}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, n)
+		}
+	}
+
+	return root, nil
+}
+
+func processUsxNode(n *node, state *usxState, styles []string) {
+	if n == nil {
+		return
+	}
+	b := state.b
+
+	switch n.Type {
+	case nodeElement:
+		switch n.Name {
+		case "book", "figure":
+			return
+		case "chapter":
+			if getAttrValue(n, "eid") != "" {
+				b.endChapter()
+				return
+			}
+			b.startChapter(getAttrValue(n, "number"), n.Pos)
+			return
+		case "verse":
+			if getAttrValue(n, "sid") != "" {
+				b.startVerse(getAttrValue(n, "number"), n.Pos)
+				return
+			}
+			if getAttrValue(n, "eid") != "" {
+				b.endVerse()
+				return
+			}
+			if state.legacyVerses && getAttrValue(n, "number") != "" {
+				b.startVerse(getAttrValue(n, "number"), n.Pos)
+				return
+			}
+		case "note":
+			b.addNote(parseUsxNote(n))
+			return
+		case "para":
+			style := getAttrValue(n, "style")
+			if isSubtitleStyle(style) {
+				b.addHeading(style, normalizeWhitespace(innerText(n)))
+				return
+			}
+			if kind := usfmMarkerKindOf(style); kind == usfmHeadingPara || kind == usfmIgnoredPara {
+				return
+			}
+			b.startParagraph(style)
+			for _, child := range n.Children {
+				processUsxNode(child, state, styles)
+			}
+			b.endParagraph()
+			return
+		case "char":
+			style := getAttrValue(n, "style")
+			if style == "sup" {
+				return
+			}
+			if style != "" {
+				styles = append(styles[:len(styles):len(styles)], style)
+			}
+			for _, child := range n.Children {
+				processUsxNode(child, state, styles)
+			}
+			return
+		}
+
+		for _, child := range n.Children {
+			processUsxNode(child, state, styles)
+		}
+	case nodeText:
+		b.addText(n.Text, styles)
+	}
+}
+
+func parseUsxNote(noteNode *node) *Note {
+	note := &Note{
+		Style:  getAttrValue(noteNode, "style"),
+		Caller: getAttrValue(noteNode, "caller"),
+	}
+	for _, child := range noteNode.Children {
+		part := NotePart{Text: innerText(child)}
+		if child.Type == nodeElement {
+			part.Style = getAttrValue(child, "style")
+		}
+		if strings.TrimSpace(part.Text) == "" {
+			continue
+		}
+		note.Parts = append(note.Parts, part)
+	}
+	return note
+}
+
+func innerText(n *node) string {
+	if n == nil {
+		return ""
+	}
+	if n.Type == nodeText {
+		return n.Text
+	}
+	if n.Name == "note" {
+		return ""
+	}
+	var b strings.Builder
+	for _, child := range n.Children {
+		b.WriteString(innerText(child))
+	}
+	return b.String()
+}
+
+func findFirstChild(n *node, name string) *node {
+	for _, child := range n.Children {
+		if child.Type == nodeElement && child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+func getAttrValue(n *node, name string) string {
+	if n == nil || n.Attrs == nil {
+		return ""
+	}
+	return n.Attrs[name]
+}
@@ -0,0 +1,104 @@
+package convert
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// writeUsx writes doc as USX 3: chapters and verses are sid/eid milestones,
+// character styles are nested <char> elements, and notes sit at the end of
+// their verse. It returns the number of verses written.
+func writeUsx(path string, doc *Document) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	w.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	w.WriteString(`<usx version="3.0">` + "\n")
+	verses := 0
+	for _, book := range doc.Books {
+		code := xmlEscaper.Replace(book.Code)
+		w.WriteString(`  <book code="` + code + `" style="id" />` + "\n")
+		for _, para := range book.Paragraphs {
+			if para.Heading != "" {
+				writeUsxHeading(w, para)
+			}
+		}
+		for _, chapter := range book.Chapters {
+			sid := code + " " + xmlEscaper.Replace(chapter.Number)
+			w.WriteString(`  <chapter number="` + xmlEscaper.Replace(chapter.Number) + `" style="c" sid="` + sid + `" />` + "\n")
+			for _, para := range chapter.layout() {
+				if para.Heading != "" || isSubtitleStyle(para.Style) {
+					writeUsxHeading(w, para)
+					continue
+				}
+				w.WriteString(`  <para style="` + xmlEscaper.Replace(para.Style) + `">`)
+				for _, verse := range para.Verses {
+					writeUsxVerse(w, sid, verse)
+				}
+				w.WriteString("\n  </para>\n")
+				verses += len(para.Verses)
+			}
+			w.WriteString(`  <chapter eid="` + sid + `" />` + "\n")
+		}
+	}
+	w.WriteString("</usx>\n")
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return verses, nil
+}
+
+func writeUsxHeading(w *bufio.Writer, para *Paragraph) {
+	if para.Heading == "" {
+		return
+	}
+	w.WriteString(`  <para style="` + xmlEscaper.Replace(para.Style) + `">` + xmlEscaper.Replace(para.Heading) + "</para>\n")
+}
+
+func writeUsxVerse(w *bufio.Writer, chapterSid string, verse *Verse) {
+	number := xmlEscaper.Replace(verse.Number)
+	sid := chapterSid + ":" + number
+	w.WriteString("\n    " + `<verse number="` + number + `" style="v" sid="` + sid + `" />`)
+
+	escaped := &Verse{Spans: make([]Span, len(verse.Spans))}
+	for i, span := range verse.Spans {
+		escaped.Spans[i] = Span{Text: xmlEscaper.Replace(span.Text), Styles: span.Styles}
+	}
+	w.WriteString(normalizeWhitespace(escaped.markupText(
+		func(style string, depth int) string { return `<char style="` + xmlEscaper.Replace(style) + `">` },
+		func(style string, depth int) string { return "</char>" },
+	)))
+	for _, note := range verse.Notes {
+		w.WriteString(usxNoteMarkup(note))
+	}
+	w.WriteString(`<verse eid="` + sid + `" />`)
+}
+
+func usxNoteMarkup(note *Note) string {
+	caller := note.Caller
+	if caller == "" {
+		caller = "+"
+	}
+	var b strings.Builder
+	b.WriteString(`<note caller="` + xmlEscaper.Replace(caller) + `" style="` + xmlEscaper.Replace(note.Style) + `">`)
+	for _, part := range note.Parts {
+		text := normalizeWhitespace(part.Text)
+		if text == "" {
+			continue
+		}
+		if part.Style == "" {
+			b.WriteString(xmlEscaper.Replace(text))
+			continue
+		}
+		b.WriteString(`<char style="` + xmlEscaper.Replace(part.Style) + `">` + xmlEscaper.Replace(text) + "</char>")
+	}
+	b.WriteString("</note>")
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package convert
+
+import (
+	"fmt"
+	"sort"
+)
+
+type FileValidation struct {
+	Input  string  `json:"input"`
+	Issues []Issue `json:"issues"`
+}
+
+type ValidationReport struct {
+	Files  []FileValidation `json:"files"`
+	Issues int              `json:"issues"`
+}
+
+// ValidateFiles parses each path and reports parser issues (unknown markers,
+// unclosed notes) together with verse-level problems: duplicate,
+// out-of-order, missing and empty verses. Files of a Paratext project in
+// opts.Projects are read with that project's encoding.
+func ValidateFiles(paths []string, opts Options) (ValidationReport, error) {
+	report := ValidationReport{}
+	for _, path := range paths {
+		doc, err := parseInput(path, opts.Projects)
+		if err != nil {
+			return ValidationReport{}, err
+		}
+		issues := validateDocument(doc)
+		report.Files = append(report.Files, FileValidation{Input: inputName(path, opts), Issues: issues})
+		report.Issues += len(issues)
+	}
+	return report, nil
+}
+
+func validateDocument(doc *Document) []Issue {
+	issues := append([]Issue{}, doc.Issues...)
+	for _, book := range doc.Books {
+		for _, chapter := range book.Chapters {
+			issues = append(issues, validateChapter(book, chapter)...)
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+	return issues
+}
+
+func validateChapter(book *Book, chapter *Chapter) []Issue {
+	var issues []Issue
+	ref := func(number string) string {
+		return fmt.Sprintf("%s %s:%s", book.Code, chapter.Number, number)
+	}
+
+	seen := map[string]bool{}
+	covered := map[int]bool{}
+	maxVerse := 0
+	var previous *Verse
+
+	for _, verse := range chapter.Verses {
+		if seen[verse.Number] {
+			issues = append(issues, Issue{Position: verse.Pos, Code: "duplicate-verse", Message: fmt.Sprintf("Duplicate verse %s", ref(verse.Number))})
+		}
+		seen[verse.Number] = true
+
+		if previous != nil && compareVerseNumbers(verse.Number, previous.Number) < 0 {
+			issues = append(issues, Issue{Position: verse.Pos, Code: "out-of-order-verse", Message: fmt.Sprintf("Verse %s follows verse %s", ref(verse.Number), previous.Number)})
+		}
+		previous = verse
+
+		if verse.PlainText() == "" {
+			issues = append(issues, Issue{Position: verse.Pos, Code: "empty-verse", Message: fmt.Sprintf("Verse %s has no text and is dropped from the output", ref(verse.Number))})
+		}
+
+		for n := verse.Start; n > 0 && n <= verse.End; n++ {
+			covered[n] = true
+		}
+		if verse.End > maxVerse {
+			maxVerse = verse.End
+		}
+	}
+
+	for n := 1; n <= maxVerse; n++ {
+		if !covered[n] {
+			issues = append(issues, Issue{Position: chapter.Pos, Code: "missing-verse", Message: fmt.Sprintf("Verse %s is missing", ref(fmt.Sprint(n)))})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,64 @@
+package convert
+
+import (
+	"regexp"
+	"strings"
+)
+
+var reVerseNumber = regexp.MustCompile(`^(\d+)([a-z]*)(?:\s*[-\x{2010}-\x{2013}]\s*(\d+)([a-z]*))?$`)
+
+type verseNumber struct {
+	start   int
+	end     int
+	segment string
+	valid   bool
+}
+
+// parseVerseNumber splits a verse number such as "3", "1-2" or "4b" into its
+// first verse, last verse and segment letter.
+func parseVerseNumber(number string) verseNumber {
+	m := reVerseNumber.FindStringSubmatch(strings.ToLower(strings.TrimSpace(number)))
+	if m == nil {
+		return verseNumber{}
+	}
+	vn := verseNumber{
+		start:   parseInt(m[1]),
+		end:     parseInt(m[1]),
+		segment: m[2],
+		valid:   true,
+	}
+	if m[3] != "" {
+		vn.end = parseInt(m[3])
+	}
+	return vn
+}
+
+func compareVerseNumbers(a, b string) int {
+	va, vb := parseVerseNumber(a), parseVerseNumber(b)
+	switch {
+	case va.valid != vb.valid:
+		if va.valid {
+			return -1
+		}
+		return 1
+	case !va.valid:
+		return strings.Compare(a, b)
+	case va.start != vb.start:
+		return compareInts(va.start, vb.start)
+	case va.segment != vb.segment:
+		return strings.Compare(va.segment, vb.segment)
+	default:
+		return compareInts(va.end, vb.end)
+	}
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
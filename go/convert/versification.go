@@ -0,0 +1,341 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	reVrsName = regexp.MustCompile(`(?i)^#\s*versification\s+"([^"]+)"`)
+	reVrsRef  = regexp.MustCompile(`^([0-9A-Z]{3})\s+(\d+):(\d+)(?:-(\d+))?$`)
+)
+
+// Versification holds the chapter and verse counts of one scheme, loaded
+// from a Paratext-style .vrs file, and its mapping lines ("PSA 3:1-8 =
+// PSA 3:2-9"), which relate verses of this scheme to the Original scheme.
+// Excluded verses ("-MAT 17:21") are counted but not expected in a text.
+type Versification struct {
+	Name         string
+	books        map[string][]int
+	excluded     map[verseRef]bool
+	toOriginal   map[verseRef]verseRef
+	fromOriginal map[verseRef]verseRef
+}
+
+type verseRef struct {
+	book    string
+	chapter int
+	verse   int
+}
+
+type VersificationReport struct {
+	Name  string         `json:"name"`
+	Books []BookCoverage `json:"books"`
+}
+
+// BookCoverage lists verses, as "chapter:verse", that the scheme expects but
+// the file lacks (Missing) and verses the file has but the scheme does not
+// (Extra).
+type BookCoverage struct {
+	Book    string   `json:"book"`
+	Missing []string `json:"missing"`
+	Extra   []string `json:"extra"`
+}
+
+func LoadVersification(path string) (*Versification, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	v := &Versification{
+		Name:         strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		books:        map[string][]int{},
+		excluded:     map[verseRef]bool{},
+		toOriginal:   map[verseRef]verseRef{},
+		fromOriginal: map[verseRef]verseRef{},
+	}
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if m := reVrsName.FindStringSubmatch(line); m != nil {
+			v.Name = m[1]
+			continue
+		}
+		// Segment lines ("*MAT 1:3,-,a,b") list the parts a verse may be
+		// split into; segments share their verse's number, so they are skipped.
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "*") {
+			continue
+		}
+		if excluded, ok := strings.CutPrefix(line, "-"); ok {
+			refs, err := parseVrsRange(excluded)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid excluded verse %q in %s line %d", line, path, lineNo)
+			}
+			for _, ref := range refs {
+				v.excluded[ref] = true
+			}
+			continue
+		}
+		if left, right, ok := strings.Cut(line, "="); ok {
+			if err := v.addMapping(left, right); err != nil {
+				return nil, fmt.Errorf("%v in %s line %d", err, path, lineNo)
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		book := strings.ToUpper(fields[0])
+		var counts []int
+		for _, field := range fields[1:] {
+			chapter, verses, ok := strings.Cut(field, ":")
+			c, errC := strconv.Atoi(chapter)
+			n, errN := strconv.Atoi(verses)
+			if !ok || errC != nil || errN != nil || c < 1 {
+				return nil, fmt.Errorf("Invalid versification entry %q in %s line %d", field, path, lineNo)
+			}
+			for len(counts) < c {
+				counts = append(counts, 0)
+			}
+			counts[c-1] = n
+		}
+		v.books[book] = counts
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (v *Versification) addMapping(left, right string) error {
+	from, err := parseVrsRange(left)
+	if err != nil {
+		return err
+	}
+	to, err := parseVrsRange(right)
+	if err != nil {
+		return err
+	}
+	for i, ref := range from {
+		target := to[min(i, len(to)-1)]
+		v.toOriginal[ref] = target
+		if _, ok := v.fromOriginal[target]; !ok {
+			v.fromOriginal[target] = ref
+		}
+	}
+	return nil
+}
+
+// overlay applies a Paratext custom.vrs: its verse counts replace those of
+// the same books, and its mapping lines are added.
+func (v *Versification) overlay(custom *Versification) {
+	for book, counts := range custom.books {
+		v.books[book] = counts
+	}
+	for ref := range custom.excluded {
+		v.excluded[ref] = true
+	}
+	for ref, target := range custom.toOriginal {
+		v.toOriginal[ref] = target
+	}
+	for ref, target := range custom.fromOriginal {
+		v.fromOriginal[ref] = target
+	}
+}
+
+func parseVrsRange(text string) ([]verseRef, error) {
+	text = strings.TrimPrefix(strings.TrimSpace(text), "&")
+	m := reVrsRef.FindStringSubmatch(strings.ToUpper(text))
+	if m == nil {
+		return nil, fmt.Errorf("Invalid versification mapping %q", text)
+	}
+	first := parseInt(m[3])
+	last := first
+	if m[4] != "" {
+		last = parseInt(m[4])
+	}
+	var refs []verseRef
+	for n := first; n <= last; n++ {
+		refs = append(refs, verseRef{book: m[1], chapter: parseInt(m[2]), verse: n})
+	}
+	return refs, nil
+}
+
+// mapVerse converts a reference in this scheme to the target scheme by way
+// of the Original scheme. References without a mapping line carry over
+// unchanged.
+func (v *Versification) mapVerse(ref verseRef, target *Versification) verseRef {
+	if orig, ok := v.toOriginal[ref]; ok {
+		ref = orig
+	}
+	if mapped, ok := target.fromOriginal[ref]; ok {
+		ref = mapped
+	}
+	return ref
+}
+
+func (v *Versification) HasBook(book string) bool {
+	_, ok := v.books[strings.ToUpper(book)]
+	return ok
+}
+
+func (v *Versification) Chapters(book string) int {
+	return len(v.books[strings.ToUpper(book)])
+}
+
+// LastVerse returns the number of verses in a chapter, or 0 when the scheme
+// does not have that chapter.
+func (v *Versification) LastVerse(book string, chapter int) int {
+	counts := v.books[strings.ToUpper(book)]
+	if chapter < 1 || chapter > len(counts) {
+		return 0
+	}
+	return counts[chapter-1]
+}
+
+func (v *Versification) isExcluded(book string, chapter, verse int) bool {
+	return v.excluded[verseRef{strings.ToUpper(book), chapter, verse}]
+}
+
+// checkVersification compares the verses that produce output rows against
+// the scheme. Excluded verses are reported neither missing nor extra. When
+// fill is set, missing verses are added to doc as empty placeholder verses.
+func checkVersification(doc *Document, v *Versification, fill bool) *VersificationReport {
+	report := &VersificationReport{Name: v.Name}
+
+	for _, book := range doc.Books {
+		coverage := BookCoverage{Book: book.Code, Missing: []string{}, Extra: []string{}}
+		seen := map[int]map[int]bool{}
+
+		for _, chapter := range book.Chapters {
+			c := parseInt(chapter.Number)
+			if seen[c] == nil {
+				seen[c] = map[int]bool{}
+			}
+			last := v.LastVerse(book.Code, c)
+			for _, verse := range chapter.Verses {
+				if verse.PlainText() == "" && !verse.Placeholder {
+					continue
+				}
+				for n := verse.Start; n > 0 && n <= verse.End; n++ {
+					if seen[c][n] {
+						continue
+					}
+					seen[c][n] = true
+					if n > last && !v.isExcluded(book.Code, c, n) {
+						coverage.Extra = append(coverage.Extra, fmt.Sprintf("%d:%d", c, n))
+					}
+				}
+			}
+		}
+
+		for c := 1; c <= v.Chapters(book.Code); c++ {
+			for n := 1; n <= v.LastVerse(book.Code, c); n++ {
+				if seen[c][n] || v.isExcluded(book.Code, c, n) {
+					continue
+				}
+				coverage.Missing = append(coverage.Missing, fmt.Sprintf("%d:%d", c, n))
+				if fill {
+					addPlaceholderVerse(book, c, n)
+				}
+			}
+		}
+
+		report.Books = append(report.Books, coverage)
+	}
+	return report
+}
+
+func addPlaceholderVerse(book *Book, chapterNumber, verseNumber int) {
+	var chapter *Chapter
+	for _, c := range book.Chapters {
+		if parseInt(c.Number) == chapterNumber {
+			chapter = c
+			break
+		}
+	}
+	if chapter == nil {
+		chapter = &Chapter{Number: strconv.Itoa(chapterNumber)}
+		book.Chapters = append(book.Chapters, chapter)
+	}
+
+	verse := &Verse{
+		Number:      strconv.Itoa(verseNumber),
+		Start:       verseNumber,
+		End:         verseNumber,
+		Placeholder: true,
+	}
+	for i, existing := range chapter.Verses {
+		if existing.Start > verseNumber {
+			chapter.Verses = append(chapter.Verses[:i], append([]*Verse{verse}, chapter.Verses[i:]...)...)
+			return
+		}
+	}
+	chapter.Verses = append(chapter.Verses, verse)
+}
+
+// remapDocument renumbers every verse from one versification to another,
+// moving verses between chapters and books when the mapping requires it.
+func remapDocument(doc *Document, from, to *Versification) {
+	type mappedVerse struct {
+		ref   verseRef
+		verse *Verse
+	}
+
+	var mapped []mappedVerse
+	books := map[string]*Book{}
+	for _, book := range doc.Books {
+		books[strings.ToUpper(book.Code)] = book
+		for _, chapter := range book.Chapters {
+			c := parseInt(chapter.Number)
+			for _, verse := range chapter.Verses {
+				if verse.Start == 0 && verse.Number != "0" {
+					mapped = append(mapped, mappedVerse{verseRef{strings.ToUpper(book.Code), c, 0}, verse})
+					continue
+				}
+				start := from.mapVerse(verseRef{strings.ToUpper(book.Code), c, verse.Start}, to)
+				end := from.mapVerse(verseRef{strings.ToUpper(book.Code), c, verse.End}, to)
+				if end.book != start.book || end.chapter != start.chapter || end.verse < start.verse {
+					end = start
+				}
+				verse.Start, verse.End = start.verse, end.verse
+				verse.Number = strconv.Itoa(start.verse) + verse.Segment
+				if end.verse != start.verse {
+					verse.Number = fmt.Sprintf("%d-%d", start.verse, end.verse)
+				}
+				mapped = append(mapped, mappedVerse{start, verse})
+			}
+			chapter.Verses = nil
+		}
+	}
+
+	for _, mv := range mapped {
+		book := books[mv.ref.book]
+		if book == nil {
+			book = &Book{Code: mv.ref.book}
+			books[mv.ref.book] = book
+			doc.Books = append(doc.Books, book)
+		}
+		var chapter *Chapter
+		for _, c := range book.Chapters {
+			if parseInt(c.Number) == mv.ref.chapter {
+				chapter = c
+				break
+			}
+		}
+		if chapter == nil {
+			chapter = &Chapter{Number: strconv.Itoa(mv.ref.chapter)}
+			book.Chapters = append(book.Chapters, chapter)
+		}
+		chapter.Verses = append(chapter.Verses, mv.verse)
+	}
+}
@@ -0,0 +1,35 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadVersificationSegmentsAndExcluded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eng.vrs")
+	content := "# Versification  \"English\"\nMAT 1:3 2:4\n*MAT 1:3,-,a,b\n-MAT 2:3\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadVersification(path)
+	if err != nil {
+		t.Fatalf("LoadVersification: %v", err)
+	}
+	if v.HasBook("-MAT") || v.HasBook("*MAT") {
+		t.Errorf("segment or excluded line was read as a book")
+	}
+	if !v.isExcluded("MAT", 2, 3) {
+		t.Errorf("MAT 2:3 is not excluded")
+	}
+
+	doc := parseUsfm(`\id MAT`+"\n"+`\c 1`+"\n"+`\p`+"\n"+`\v 1 a`+"\n"+`\v 2 b`+"\n"+`\v 3 c`+"\n"+
+		`\c 2`+"\n"+`\p`+"\n"+`\v 1 a`+"\n"+`\v 2 b`+"\n"+`\v 4 d`, "usfm", "")
+	report := checkVersification(doc, v, false)
+	want := []BookCoverage{{Book: "MAT", Missing: []string{}, Extra: []string{}}}
+	if !reflect.DeepEqual(report.Books, want) {
+		t.Errorf("coverage = %+v, want %+v", report.Books, want)
+	}
+}
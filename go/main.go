@@ -5,10 +5,16 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"usxtocsv/convert"
 )
 
+// openBundles are closed before exit so extracted zips do not outlive the run.
+var openBundles []*convert.Bundle
+
 type stringSlice []string
 
 func (s *stringSlice) String() string {
@@ -21,12 +27,48 @@ func (s *stringSlice) Set(value string) error {
 }
 
 func main() {
-	var inputs stringSlice
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			runValidate(os.Args[2:])
+			return
+		case "roundtrip":
+			runRoundTrip(os.Args[2:])
+			return
+		case "csv2usfm":
+			runReverse("csv2usfm", convert.OutputUSFM, os.Args[2:])
+			return
+		case "csv2usx":
+			runReverse("csv2usx", convert.OutputUSX, os.Args[2:])
+			return
+		}
+	}
+
+	var inputs, labels, includes, excludes stringSlice
 	output := flag.String("output", "", "Output folder (optional)")
 	help := flag.Bool("help", false, "Show help")
 	quiet := flag.Bool("quiet", false, "Suppress progress output")
 	jsonOut := flag.Bool("json", false, "Output JSON summary to stdout")
+	format := flag.String("format", "csv", "Output format: csv, json, or jsonl")
+	noteMode := flag.String("note-mode", "ft-only", "Note content to output: ft-only, full, or structured")
+	notesCsv := flag.Bool("notes-csv", false, "Also write <name>.notes.csv with one row per note and its position in TextPlain")
+	preserveOrder := flag.Bool("preserve-order", false, "Keep verses in document order instead of sorting")
+	vrsPath := flag.String("versification", "", "Versification .vrs file to check verses against (optional)")
+	vrsDir := flag.String("versification-dir", "", "Folder of standard .vrs files used for Paratext project versifications")
+	targetVrsPath := flag.String("target-versification", "", "Versification .vrs file to renumber verses into (requires -versification)")
+	fillGaps := flag.Bool("fill-gaps", false, "Emit empty rows for verses missing from the versification")
+	parallel := flag.Bool("parallel", false, "Write one aligned CSV per book with a TextPlain column per translation")
+	merge := flag.String("merge", "", "Write all books to this one CSV in canonical order")
+	keepGoing := flag.Bool("keep-going", false, "Continue past files that fail and report them in the summary")
+	nameTemplate := flag.String("name-template", "", "Output file name template using {book}, {bookNum}, {language}, {format}, {input}, {dir}")
+	language := flag.String("language", "", "Language code for the {language} name template placeholder")
+	onCollision := flag.String("on-collision", "fail", "When two inputs map to one output: fail or rename")
+	recursive := flag.Bool("recursive", false, "Search input folders recursively")
+	jobs := flag.Int("jobs", 1, "Number of files to convert at once (0 uses all CPUs)")
 	flag.Var(&inputs, "input", "Input file/folder/wildcard path (repeatable)")
+	flag.Var(&labels, "label", "Translation label for -parallel, one per -input (repeatable)")
+	flag.Var(&includes, "include", "Only convert files whose name or relative path matches this glob (repeatable)")
+	flag.Var(&excludes, "exclude", "Skip files and subfolders matching this glob (repeatable)")
 	flag.Parse()
 
 	if *help || len(inputs) == 0 {
@@ -34,50 +76,212 @@ func main() {
 		return
 	}
 
-	inputItems, err := convert.ResolveInputItems(inputs)
-	if err != nil {
-		fail(err.Error(), *jsonOut)
+	opts := convert.Options{
+		Quiet:         *quiet,
+		OutputFormat:  *format,
+		PreserveOrder: *preserveOrder,
+		FillGaps:      *fillGaps,
+		Parallel:      *parallel,
+		Merge:         *merge,
+		NoteMode:      *noteMode,
+		NotesCSV:      *notesCsv,
+		Jobs:          *jobs,
+		KeepGoing:     *keepGoing,
+		NameTemplate:  *nameTemplate,
+		Language:      *language,
+		OnCollision:   *onCollision,
 	}
-
-	files, err := convert.CollectFiles(inputItems)
-	if err != nil {
-		fail(err.Error(), *jsonOut)
+	if opts.Jobs <= 0 {
+		opts.Jobs = runtime.NumCPU()
 	}
 
-	if len(files) == 0 {
-		fail("No .usx, .usfm, or .sfm files found.", *jsonOut)
+	collect := convert.CollectOptions{Recursive: *recursive, Include: includes, Exclude: excludes}
+	var files []string
+	if len(labels) > 0 {
+		if len(labels) != len(inputs) {
+			fail("-label must be given once per -input", *jsonOut)
+		}
+		for i, input := range inputs {
+			set := collectInputs([]string{input}, collect, *vrsDir, *jsonOut)
+			files = append(files, set.files...)
+			opts.InputRoots = append(opts.InputRoots, set.roots...)
+			opts.Projects = append(opts.Projects, set.projects...)
+			opts.Bundles = append(opts.Bundles, set.bundles...)
+			for range set.files {
+				opts.Labels = append(opts.Labels, labels[i])
+			}
+		}
+	} else {
+		set := collectInputs(inputs, collect, *vrsDir, *jsonOut)
+		files, opts.InputRoots = set.files, set.roots
+		opts.Projects, opts.Bundles = set.projects, set.bundles
+	}
+	if *vrsPath != "" {
+		vrs, err := convert.LoadVersification(*vrsPath)
+		if err != nil {
+			fail(err.Error(), *jsonOut)
+		}
+		opts.Versification = vrs
+	} else if (*fillGaps || *targetVrsPath != "") && !projectsHaveVersification(opts.Projects) {
+		fail("-fill-gaps and -target-versification require -versification", *jsonOut)
+	}
+	if *targetVrsPath != "" {
+		vrs, err := convert.LoadVersification(*targetVrsPath)
+		if err != nil {
+			fail(err.Error(), *jsonOut)
+		}
+		opts.TargetVersification = vrs
 	}
 
-	summary, err := convert.ConvertFiles(files, *output, convert.Options{Quiet: *quiet})
+	summary, err := convert.ConvertFiles(files, *output, opts)
+	closeBundles()
 	if err != nil {
 		fail(err.Error(), *jsonOut)
 	}
 
 	if *jsonOut {
 		writeJSONSummary(summary)
-		return
+	} else if summary.Failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d files failed.\n", summary.Failed, len(summary.Files))
+	} else {
+		fmt.Println("All conversions completed.")
 	}
+	if code := exitCode(summary); code != 0 {
+		os.Exit(code)
+	}
+}
 
-	fmt.Println("All conversions completed.")
+// exitCode is 0 when every file converted, 2 when only some did (possible
+// with -keep-going), and 1 when none did.
+func exitCode(summary convert.Summary) int {
+	switch {
+	case summary.Failed == 0:
+		return 0
+	case summary.Failed < len(summary.Files):
+		return 2
+	default:
+		return 1
+	}
 }
 
 func showUsage() {
-	fmt.Println("usxtocsv (Go) - Convert USX/USFM/SFM to CSV")
+	fmt.Println("usxtocsv (Go) - Convert USX/USFM/SFM/USJ to CSV")
 	fmt.Println("")
 	fmt.Println("Usage:")
 	fmt.Println("  usxtocsv -input <file|folder|wildcard> [-output <folder>]")
 	fmt.Println("  usxtocsv -input <path1> -input <path2>")
+	fmt.Println("  usxtocsv -input <path> -format json|jsonl|csv")
+	fmt.Println("  usxtocsv -input <path> -preserve-order")
+	fmt.Println("  usxtocsv -input <path> -note-mode full|structured")
+	fmt.Println("  usxtocsv -input <path> -notes-csv")
+	fmt.Println("  usxtocsv -input <path> -versification eng.vrs [-fill-gaps]")
+	fmt.Println("  usxtocsv -input <path> -versification org.vrs -target-versification eng.vrs")
 	fmt.Println("  usxtocsv -quiet -json")
+	fmt.Println("  usxtocsv -input <folder> -jobs 8")
+	fmt.Println("  usxtocsv -input <folder> -recursive [-include \"*.SFM\"] [-exclude \"backup\"] -output <folder>")
+	fmt.Println("  usxtocsv -input <folder> -keep-going -json")
+	fmt.Println("  usxtocsv -input <dir1> -input <dir2> -output <folder> -on-collision rename")
+	fmt.Println("  usxtocsv -input <path> -output <folder> -name-template \"{dir}_{book}_{format}.csv\"")
+	fmt.Println("  usxtocsv -input <folder> -name-template \"{bookNum}{book}_{language}\" -language eng")
+	fmt.Println("  usxtocsv -input <paratext-project> [-versification-dir <folder>]")
+	fmt.Println("  usxtocsv -input <dbl-bundle.zip|folder> [-output <folder>]")
+	fmt.Println("  usxtocsv -input <folder> -merge bible.csv")
+	fmt.Println("  usxtocsv -parallel -input <dir1> -label KJV -input <dir2> -label WEB")
+	fmt.Println("  usxtocsv validate -input <path> [-json]")
+	fmt.Println("  usxtocsv roundtrip -input <path> [-json]")
+	fmt.Println("  usxtocsv csv2usfm -input <csv|folder> [-output <folder>]")
+	fmt.Println("  usxtocsv csv2usx -input <csv|folder> [-output <folder>]")
 	fmt.Println("  usxtocsv -help")
 }
 
-func writeJSONSummary(runSummary convert.Summary) {
+// inputSet is what -input values resolve to. Roots are the folders among
+// them, so outputs can mirror their layout; Paratext project folders and DBL
+// bundles are listed in projects and bundles and contribute their book files.
+type inputSet struct {
+	files    []string
+	roots    []string
+	projects []*convert.Project
+	bundles  []*convert.Bundle
+}
+
+func collectInputs(inputs []string, collect convert.CollectOptions, vrsDir string, jsonOut bool) inputSet {
+	inputItems, err := convert.ResolveInputItems(inputs)
+	if err != nil {
+		fail(err.Error(), jsonOut)
+	}
+
+	var set inputSet
+	var plain []string
+	for _, item := range inputItems {
+		info, err := os.Stat(item)
+		isZip := err == nil && !info.IsDir() && strings.EqualFold(filepath.Ext(item), ".zip")
+		if err != nil || (!info.IsDir() && !isZip) {
+			plain = append(plain, item)
+			continue
+		}
+		if info.IsDir() {
+			set.roots = append(set.roots, item)
+		}
+
+		switch {
+		case isZip || convert.IsBundleDir(item):
+			bundle, err := convert.OpenBundle(item)
+			if err != nil {
+				fail(err.Error(), jsonOut)
+			}
+			openBundles = append(openBundles, bundle)
+			set.bundles = append(set.bundles, bundle)
+			set.files = append(set.files, bundle.Files()...)
+		case convert.IsProjectDir(item):
+			project, err := convert.LoadProject(item, vrsDir)
+			if err != nil {
+				fail(err.Error(), jsonOut)
+			}
+			set.projects = append(set.projects, project)
+			for _, book := range project.Books {
+				set.files = append(set.files, book.Path)
+			}
+		default:
+			plain = append(plain, item)
+		}
+	}
+
+	files, err := convert.CollectFiles(plain, collect)
+	if err != nil {
+		fail(err.Error(), jsonOut)
+	}
+	set.files = append(set.files, files...)
+
+	if len(set.files) == 0 {
+		fail("No .usx, .usfm, .sfm, .usj, or .json files found.", jsonOut)
+	}
+	return set
+}
+
+func projectsHaveVersification(projects []*convert.Project) bool {
+	for _, project := range projects {
+		if project.VersificationFile == "" {
+			return false
+		}
+	}
+	return len(projects) > 0
+}
+
+func writeJSONSummary(runSummary any) {
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
 	_ = enc.Encode(runSummary)
 }
 
+func closeBundles() {
+	for _, bundle := range openBundles {
+		bundle.Close()
+	}
+	openBundles = nil
+}
+
 func fail(message string, jsonOut bool) {
+	closeBundles()
 	if jsonOut {
 		out := map[string]string{"error": message}
 		enc := json.NewEncoder(os.Stdout)
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"usxtocsv/convert"
+)
+
+// runReverse handles the commands that turn CSVs back into source files, such
+// as csv2usfm and csv2usx.
+func runReverse(command, format string, args []string) {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	var inputs, includes, excludes stringSlice
+	output := fs.String("output", "", "Output folder (optional)")
+	help := fs.Bool("help", false, "Show help")
+	quiet := fs.Bool("quiet", false, "Suppress progress output")
+	jsonOut := fs.Bool("json", false, "Output JSON summary to stdout")
+	recursive := fs.Bool("recursive", false, "Search input folders recursively")
+	overwrite := fs.Bool("overwrite", false, "Replace output files that already exist, such as the original source")
+	keepGoing := fs.Bool("keep-going", false, "Continue past files that fail and report them in the summary")
+	jobs := fs.Int("jobs", 1, "Number of files to convert at once (0 uses all CPUs)")
+	fs.Var(&inputs, "input", "Input CSV file/folder/wildcard path (repeatable)")
+	fs.Var(&includes, "include", "Only convert files whose name or relative path matches this glob (repeatable)")
+	fs.Var(&excludes, "exclude", "Skip files and subfolders matching this glob (repeatable)")
+	fs.Parse(args)
+
+	if *help || len(inputs) == 0 {
+		showReverseUsage(command, format)
+		return
+	}
+
+	items, err := convert.ResolveInputItems(inputs)
+	if err != nil {
+		fail(err.Error(), *jsonOut)
+	}
+	var roots []string
+	for _, item := range items {
+		if info, err := os.Stat(item); err == nil && info.IsDir() {
+			roots = append(roots, item)
+		}
+	}
+	files, err := convert.CollectFiles(items, convert.CollectOptions{Recursive: *recursive, Include: includes, Exclude: excludes, CSV: true})
+	if err != nil {
+		fail(err.Error(), *jsonOut)
+	}
+	if len(files) == 0 {
+		fail("No .csv files found.", *jsonOut)
+	}
+
+	opts := convert.Options{
+		Quiet:        *quiet,
+		OutputFormat: format,
+		Jobs:         *jobs,
+		KeepGoing:    *keepGoing,
+		Overwrite:    *overwrite,
+		InputRoots:   roots,
+	}
+	if opts.Jobs <= 0 {
+		opts.Jobs = runtime.NumCPU()
+	}
+
+	summary, err := convert.ConvertCsvFiles(files, *output, opts)
+	if err != nil {
+		fail(err.Error(), *jsonOut)
+	}
+
+	if *jsonOut {
+		writeJSONSummary(summary)
+	} else if summary.Failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d files failed.\n", summary.Failed, len(summary.Files))
+	} else {
+		fmt.Println("All conversions completed.")
+	}
+	if code := exitCode(summary); code != 0 {
+		os.Exit(code)
+	}
+}
+
+func showReverseUsage(command, format string) {
+	fmt.Printf("usxtocsv %s - Convert CSVs written by usxtocsv back to %s\n", command, strings.ToUpper(format))
+	fmt.Println("")
+	fmt.Println("Usage:")
+	fmt.Printf("  usxtocsv %s -input <file|folder|wildcard> [-output <folder>]\n", command)
+	fmt.Printf("  usxtocsv %s -input <folder> -recursive [-include <glob>] [-exclude <glob>]\n", command)
+	fmt.Printf("  usxtocsv %s -input <path> -keep-going -json\n", command)
+	fmt.Printf("  usxtocsv %s -input <path> -overwrite\n", command)
+	fmt.Println("")
+	fmt.Println("Columns are read by header name. Book, Chapter, Verse and TextStyled or TextPlain are required.")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"usxtocsv/convert"
+)
+
+func runRoundTrip(args []string) {
+	fs := flag.NewFlagSet("roundtrip", flag.ExitOnError)
+	var inputs, includes, excludes stringSlice
+	help := fs.Bool("help", false, "Show help")
+	jsonOut := fs.Bool("json", false, "Output JSON report to stdout")
+	recursive := fs.Bool("recursive", false, "Search input folders recursively")
+	noteMode := fs.String("note-mode", "ft-only", "Note content in the intermediate CSV: ft-only, full, or structured")
+	preserveOrder := fs.Bool("preserve-order", false, "Keep verses in document order instead of sorting")
+	fs.Var(&inputs, "input", "Input file/folder/wildcard path (repeatable)")
+	fs.Var(&includes, "include", "Only check files whose name or relative path matches this glob (repeatable)")
+	fs.Var(&excludes, "exclude", "Skip files and subfolders matching this glob (repeatable)")
+	fs.Parse(args)
+
+	if *help || len(inputs) == 0 {
+		showRoundTripUsage()
+		return
+	}
+
+	collect := convert.CollectOptions{Recursive: *recursive, Include: includes, Exclude: excludes}
+	set := collectInputs(inputs, collect, "", *jsonOut)
+	report, err := convert.CheckRoundTrip(set.files, convert.Options{
+		PreserveOrder: *preserveOrder,
+		NoteMode:      *noteMode,
+		Projects:      set.projects,
+		Bundles:       set.bundles,
+	})
+	closeBundles()
+	if err != nil {
+		fail(err.Error(), *jsonOut)
+	}
+
+	if *jsonOut {
+		writeJSONSummary(report)
+	} else {
+		for _, file := range report.Files {
+			for _, issue := range file.Issues {
+				fmt.Printf("%s: %s (%s)\n", issueLocation(file.Input, issue), issue.Message, issue.Code)
+			}
+		}
+		fmt.Printf("%d difference(s) in %d file(s).\n", report.Issues, len(report.Files))
+	}
+
+	if report.Issues > 0 {
+		os.Exit(1)
+	}
+}
+
+func showRoundTripUsage() {
+	fmt.Println("usxtocsv roundtrip - Check that USX/USFM/SFM files survive conversion to CSV and back")
+	fmt.Println("")
+	fmt.Println("Usage:")
+	fmt.Println("  usxtocsv roundtrip -input <file|folder|wildcard>")
+	fmt.Println("  usxtocsv roundtrip -input <path> -json")
+	fmt.Println("  usxtocsv roundtrip -input <folder> -recursive [-include <glob>] [-exclude <glob>]")
+	fmt.Println("")
+	fmt.Println("Exit code is 1 when any verse differs after the round trip.")
+}
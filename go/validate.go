@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"usxtocsv/convert"
+)
+
+func runValidate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	var inputs, includes, excludes stringSlice
+	help := fs.Bool("help", false, "Show help")
+	jsonOut := fs.Bool("json", false, "Output JSON report to stdout")
+	recursive := fs.Bool("recursive", false, "Search input folders recursively")
+	fs.Var(&inputs, "input", "Input file/folder/wildcard path (repeatable)")
+	fs.Var(&includes, "include", "Only check files whose name or relative path matches this glob (repeatable)")
+	fs.Var(&excludes, "exclude", "Skip files and subfolders matching this glob (repeatable)")
+	fs.Parse(args)
+
+	if *help || len(inputs) == 0 {
+		showValidateUsage()
+		return
+	}
+
+	collect := convert.CollectOptions{Recursive: *recursive, Include: includes, Exclude: excludes}
+	set := collectInputs(inputs, collect, "", *jsonOut)
+	report, err := convert.ValidateFiles(set.files, convert.Options{Projects: set.projects, Bundles: set.bundles})
+	closeBundles()
+	if err != nil {
+		fail(err.Error(), *jsonOut)
+	}
+
+	if *jsonOut {
+		writeJSONSummary(report)
+	} else {
+		for _, file := range report.Files {
+			for _, issue := range file.Issues {
+				fmt.Printf("%s: %s (%s)\n", issueLocation(file.Input, issue), issue.Message, issue.Code)
+			}
+		}
+		fmt.Printf("%d issue(s) in %d file(s).\n", report.Issues, len(report.Files))
+	}
+
+	if report.Issues > 0 {
+		os.Exit(1)
+	}
+}
+
+func issueLocation(path string, issue convert.Issue) string {
+	if issue.Line == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s:%d:%d", path, issue.Line, issue.Column)
+}
+
+func showValidateUsage() {
+	fmt.Println("usxtocsv validate - Report structural problems in USX/USFM/SFM/USJ files")
+	fmt.Println("")
+	fmt.Println("Usage:")
+	fmt.Println("  usxtocsv validate -input <file|folder|wildcard>")
+	fmt.Println("  usxtocsv validate -input <path> -json")
+	fmt.Println("  usxtocsv validate -input <folder> -recursive [-include <glob>] [-exclude <glob>]")
+	fmt.Println("")
+	fmt.Println("Exit code is 1 when any issue is found.")
+}
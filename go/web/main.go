@@ -5,9 +5,11 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -123,7 +125,21 @@ func handleConvert(w http.ResponseWriter, r *http.Request) {
 	}
 	defer os.RemoveAll(tempDir)
 
-	inputPaths, err := saveUploads(tempDir, files)
+	// Uploads go in their own folder so that no upload or extracted zip can
+	// share a folder with the output.
+	inputDir := filepath.Join(tempDir, "in")
+	if err := os.Mkdir(inputDir, 0o755); err != nil {
+		http.Error(w, "Failed to create temp directory", http.StatusInternalServerError)
+		return
+	}
+
+	inputPaths, err := saveUploads(inputDir, files)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bundles, inputPaths, err := collectBundles(inputDir, inputPaths)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -131,12 +147,18 @@ func handleConvert(w http.ResponseWriter, r *http.Request) {
 
 	inputPaths = filterSupported(inputPaths)
 	if len(inputPaths) == 0 {
-		http.Error(w, "No .usx, .usfm, or .sfm files found in upload", http.StatusBadRequest)
+		http.Error(w, "No .usx, .usfm, .sfm, .usj, or .json files found in upload", http.StatusBadRequest)
 		return
 	}
 
 	outputDir := filepath.Join(tempDir, "out")
-	if _, err := convert.ConvertFiles(inputPaths, outputDir, convert.Options{Quiet: true}); err != nil {
+	opts := convert.Options{
+		Quiet:       true,
+		InputRoots:  []string{inputDir},
+		OnCollision: convert.CollisionRename,
+		Bundles:     bundles,
+	}
+	if _, err := convert.ConvertFiles(inputPaths, outputDir, opts); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -182,7 +204,8 @@ func saveUploads(baseDir string, files []*multipart.FileHeader) ([]string, error
 		dest.Close()
 
 		if strings.HasSuffix(strings.ToLower(name), ".zip") {
-			extracted, err := extractZip(destPath, baseDir)
+			zipDir := unusedPath(filepath.Join(baseDir, strings.TrimSuffix(name, filepath.Ext(name))))
+			extracted, err := extractZip(destPath, zipDir)
 			if err != nil {
 				return nil, err
 			}
@@ -196,6 +219,18 @@ func saveUploads(baseDir string, files []*multipart.FileHeader) ([]string, error
 	return paths, nil
 }
 
+// unusedPath adds a numeric suffix to path while something already exists
+// there, so two uploads never extract into the same folder.
+func unusedPath(path string) string {
+	candidate := path
+	for n := 2; ; n++ {
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s_%d", path, n)
+	}
+}
+
 func extractZip(zipPath, destDir string) ([]string, error) {
 	reader, err := zip.OpenReader(zipPath)
 	if err != nil {
@@ -208,7 +243,7 @@ func extractZip(zipPath, destDir string) ([]string, error) {
 		if file.FileInfo().IsDir() {
 			continue
 		}
-		name := sanitizeFilename(file.Name)
+		name := zipEntryPath(file.Name)
 		if name == "" {
 			continue
 		}
@@ -240,13 +275,63 @@ func extractZip(zipPath, destDir string) ([]string, error) {
 	return extracted, nil
 }
 
+// collectBundles finds DBL bundles among the extracted zips and replaces their
+// files with the USX books listed in each bundle's metadata.xml.
+func collectBundles(baseDir string, paths []string) ([]*convert.Bundle, []string, error) {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var bundles []*convert.Bundle
+	var bundleDirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(baseDir, entry.Name())
+		root := convert.FindBundleRoot(dir)
+		if root == "" {
+			continue
+		}
+		bundle, err := convert.OpenBundle(root)
+		if err != nil {
+			return nil, nil, err
+		}
+		bundles = append(bundles, bundle)
+		bundleDirs = append(bundleDirs, dir+string(filepath.Separator))
+	}
+
+	var rest []string
+	for _, p := range paths {
+		inBundle := false
+		for _, dir := range bundleDirs {
+			if strings.HasPrefix(p, dir) {
+				inBundle = true
+				break
+			}
+		}
+		if !inBundle {
+			rest = append(rest, p)
+		}
+	}
+	for _, bundle := range bundles {
+		rest = append(rest, bundle.Files()...)
+	}
+	return bundles, rest, nil
+}
+
 func filterSupported(paths []string) []string {
 	var filtered []string
 	for _, path := range paths {
 		ext := strings.ToLower(filepath.Ext(path))
 		switch ext {
-		case ".usx", ".usfm", ".sfm":
+		case ".usx", ".usfm", ".sfm", ".usj":
 			filtered = append(filtered, path)
+		case ".json":
+			if convert.LooksLikeUsj(path) {
+				filtered = append(filtered, path)
+			}
 		}
 	}
 	return filtered
@@ -259,40 +344,48 @@ func sanitizeFilename(name string) string {
 	return name
 }
 
+// zipEntryPath keeps the folders inside a zip so that books with the same
+// name in different folders stay apart. Entries that would escape the
+// extraction folder are dropped.
+func zipEntryPath(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Clean("/" + strings.TrimSpace(name))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" || name == "." {
+		return ""
+	}
+	return filepath.FromSlash(name)
+}
+
 func writeZip(w io.Writer, dir string) error {
 	zipWriter := zip.NewWriter(w)
 	defer zipWriter.Close()
 
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	return filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
-		path := filepath.Join(dir, entry.Name())
-		if strings.ToLower(filepath.Ext(path)) != ".csv" {
-			continue
+		if entry.IsDir() || strings.ToLower(filepath.Ext(p)) != ".csv" {
+			return nil
 		}
-
-		file, err := os.Open(path)
+		rel, err := filepath.Rel(dir, p)
 		if err != nil {
 			return err
 		}
-		defer file.Close()
 
-		wr, err := zipWriter.Create(entry.Name())
+		file, err := os.Open(p)
 		if err != nil {
 			return err
 		}
-		if _, err := io.Copy(wr, file); err != nil {
+		defer file.Close()
+
+		wr, err := zipWriter.Create(filepath.ToSlash(rel))
+		if err != nil {
 			return err
 		}
-	}
-
-	return nil
+		_, err = io.Copy(wr, file)
+		return err
+	})
 }
 
 const indexHTML = `<!doctype html>
@@ -358,11 +451,11 @@ const indexHTML = `<!doctype html>
   </head>
   <body>
     <div class="wrap">
-      <h1>USX / USFM / SFM to CSV</h1>
+      <h1>USX / USFM / SFM / USJ to CSV</h1>
       <p>Upload one or more files, or a zip containing multiple files. The server returns a zip of CSVs.</p>
       <form class="drop" action="/convert" method="post" enctype="multipart/form-data">
         <input type="file" name="files" multiple />
-        <div class="note">Accepted: .usx, .usfm, .sfm, or .zip</div>
+        <div class="note">Accepted: .usx, .usfm, .sfm, .usj, .json, or .zip</div>
         <button class="btn" type="submit">Convert</button>
       </form>
     </div>
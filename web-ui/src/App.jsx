@@ -9,7 +9,7 @@ export default function App() {
   const [downloadUrl, setDownloadUrl] = useState("");
 
   const acceptedList = useMemo(
-    () => ".usx,.usfm,.sfm,.zip",
+    () => ".usx,.usfm,.sfm,.usj,.json,.zip",
     []
   );
 
@@ -57,7 +57,7 @@ export default function App() {
   return (
     <div className="page">
       <header className="hero">
-        <div className="hero__pill">USX / USFM / SFM</div>
+        <div className="hero__pill">USX / USFM / SFM / USJ</div>
         <h1>Turn scripture sources into clean CSVs.</h1>
         <p>
           Upload files or a zip bundle. The converter returns a zip with
@@ -77,7 +77,7 @@ export default function App() {
             <div>
               <strong>Drop files here</strong> or browse
             </div>
-            <span>Accepted: .usx .usfm .sfm .zip</span>
+            <span>Accepted: .usx .usfm .sfm .usj .json .zip</span>
           </label>
 
           <div className="filelist">